@@ -1,27 +1,244 @@
 package main
 
 import (
+	"cmp"
+	"flag"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 )
 
 type command struct {
 	name string
 	args []string
+	// usage is filled in from the registered commandInfo when the command runs
+	usage string
+}
+
+// usageError returns the usage of the command as an error
+func (cmd command) usageError() error {
+	if cmd.usage == "" {
+		return fmt.Errorf("usage: %s", cmd.name)
+	}
+	return fmt.Errorf("usage: %s", cmd.usage)
+}
+
+// parseFlags parses the flags of a command, flags can come before, after or
+// between the positional args which are returned
+func (cmd command) parseFlags(fs *flag.FlagSet) ([]string, error) {
+	fs.SetOutput(io.Discard)
+
+	var positional []string
+	args := cmd.args
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%v\n%w", err, cmd.usageError())
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+type argKind int
+
+const (
+	argText argKind = iota
+	argNumber
+	argDuration
+	argUsername
+	argFeedURL
+	argPostID
+	argProfile
+	argCommand
+	argShell
+)
+
+// argSpec describes one positional argument of a command
+type argSpec struct {
+	name     string
+	kind     argKind
+	optional bool
+}
+
+// flagSpec describes one flag of a command, value is the placeholder shown
+// in the usage and is empty for bool flags
+type flagSpec struct {
+	name        string
+	value       string
+	kind        argKind
+	description string
+}
+
+// commandInfo is everything we know about a command, help, usage errors and
+// completion are all generated from it
+type commandInfo struct {
+	name        string
+	description string
+	args        []argSpec
+	flags       []flagSpec
+	subcommands []commandInfo
+	examples    []string
+	handler     func(*state, command) error
+}
+
+// usage returns the usage line of the command, commands with subcommands
+// get a line for each one
+func (info commandInfo) usage() string {
+	if len(info.subcommands) == 0 {
+		return joinNonEmpty(info.name, formatFlags(info.flags), formatArgs(info.args))
+	}
+
+	lines := make([]string, 0, len(info.subcommands))
+	for _, sub := range info.subcommands {
+		lines = append(lines, joinNonEmpty(info.name, sub.name, formatFlags(sub.flags), formatArgs(sub.args)))
+	}
+	return strings.Join(lines, "\n       ")
+}
+
+func joinNonEmpty(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// flag returns the spec of a flag given as "-name" or "--name"
+func (info commandInfo) flag(arg string) (flagSpec, bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return flagSpec{}, false
+	}
+	name := strings.TrimLeft(arg, "-")
+	for _, f := range info.flags {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return flagSpec{}, false
+}
+
+// subcommand returns the info for one of the subcommands of the command
+func (info commandInfo) subcommand(name string) (commandInfo, bool) {
+	for _, sub := range info.subcommands {
+		if sub.name == name {
+			return sub, true
+		}
+	}
+	return commandInfo{}, false
+}
+
+func formatFlags(flags []flagSpec) string {
+	parts := make([]string, 0, len(flags))
+	for _, f := range flags {
+		if f.value == "" {
+			parts = append(parts, "[--"+f.name+"]")
+		} else {
+			parts = append(parts, "[--"+f.name+" <"+f.value+">]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatArgs(args []argSpec) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg.optional {
+			parts = append(parts, "["+arg.name+"]")
+		} else {
+			parts = append(parts, "<"+arg.name+">")
+		}
+	}
+	return strings.Join(parts, " ")
 }
 
 type commands struct {
-	handlers map[string]func(*state, command) error
+	handlers map[string]commandInfo
+	// names keeps the commands in the order they were registered
+	names []string
 }
 
 func (c *commands) run(s *state, cmd command) error {
-	handler, ok := c.handlers[cmd.name]
+	info, ok := c.handlers[cmd.name]
 	if !ok {
-		return fmt.Errorf("unknown command: %s", cmd.name)
+		return c.unknownCommandError(cmd.name)
+	}
+
+	cmd.usage = info.usage()
+	return info.handler(s, cmd)
+}
+
+func (c *commands) register(info commandInfo) {
+	if _, ok := c.handlers[info.name]; !ok {
+		c.names = append(c.names, info.name)
 	}
+	c.handlers[info.name] = info
+}
 
-	return handler(s, cmd)
+// list returns the registered commands in the order they were registered
+func (c *commands) list() []commandInfo {
+	infos := make([]commandInfo, 0, len(c.names))
+	for _, name := range c.names {
+		infos = append(infos, c.handlers[name])
+	}
+	return infos
 }
 
-func (c *commands) register(name string, f func(*state, command) error) {
-	c.handlers[name] = f
+// unknownCommandError suggests the commands the user may have meant
+func (c *commands) unknownCommandError(name string) error {
+	if suggestions := c.suggest(name); len(suggestions) > 0 {
+		return fmt.Errorf("unknown command: %s, did you mean: %s?", name, strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("unknown command: %s, run \"help\" to see all the commands", name)
+}
+
+// maxSuggestionDistance is how many edits a typo can be from a command
+const maxSuggestionDistance = 2
+
+// suggest returns the commands that are close to an unknown command name,
+// closest first and in the order they were registered when as close
+func (c *commands) suggest(name string) []string {
+	var suggestions []string
+	distances := make(map[string]int)
+	for _, candidate := range c.names {
+		distance := levenshtein(name, candidate)
+		if distance <= maxSuggestionDistance ||
+			(len(name) > 1 && strings.HasPrefix(candidate, name)) {
+			suggestions = append(suggestions, candidate)
+			distances[candidate] = distance
+		}
+	}
+	slices.SortStableFunc(suggestions, func(a, b string) int {
+		return cmp.Compare(distances[a], distances[b])
+	})
+	return suggestions
+}
+
+// levenshtein returns the number of single char edits to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
 }
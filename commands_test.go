@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "agg", want: 3},
+		{a: "agg", b: "", want: 3},
+		{a: "login", b: "login", want: 0},
+		{a: "logn", b: "login", want: 1},
+		{a: "loggin", b: "login", want: 1},
+		{a: "lagin", b: "login", want: 1},
+		{a: "lgoin", b: "login", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "brówse", b: "browse", want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	cmds := &commands{handlers: make(map[string]commandInfo)}
+	for _, name := range []string{"feeds", "feed", "follow", "read", "reset", "users"} {
+		cmds.register(commandInfo{name: name})
+	}
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "usres", want: []string{"users"}},
+		{name: "fllw", want: []string{"follow"}},
+		{name: "flw", want: nil},
+		// Closer commands come first, ties keep the order they were registered in
+		{name: "feedz", want: []string{"feeds", "feed"}},
+		{name: "fee", want: []string{"feed", "feeds"}},
+		// A prefix of a command is suggested however far it is
+		{name: "fol", want: []string{"follow"}},
+		{name: "f", want: nil},
+		{name: "reed", want: []string{"feed", "read", "feeds", "reset"}},
+		{name: "nope", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cmds.suggest(tt.name)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("suggest(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+			// The same suggestions come back in the same order every time
+			for range 10 {
+				if again := cmds.suggest(tt.name); !slices.Equal(again, got) {
+					t.Fatalf("suggest(%q) = %q, then %q", tt.name, got, again)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownCommandError(t *testing.T) {
+	cmds := &commands{handlers: make(map[string]commandInfo)}
+	registerCommands(cmds)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "logn", want: "unknown command: logn, did you mean: login?"},
+		{name: "xyzzy", want: `unknown command: xyzzy, run "help" to see all the commands`},
+	}
+	for _, tt := range tests {
+		if err := cmds.unknownCommandError(tt.name); err.Error() != tt.want {
+			t.Errorf("unknownCommandError(%q) = %q, want %q", tt.name, err, tt.want)
+		}
+	}
+}
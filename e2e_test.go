@@ -0,0 +1,1004 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/database/sqlite"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+// e2eStores are the stores the scenarios run against, Postgres is added
+// when GATOR_TEST_DB_URL is set
+func e2eStores(t *testing.T) map[string]func(t *testing.T) database.Store {
+	stores := map[string]func(t *testing.T) database.Store{
+		"memory": func(t *testing.T) database.Store { return memory.New() },
+		"sqlite": func(t *testing.T) database.Store {
+			s, err := sqlite.Open(filepath.Join(t.TempDir(), "gator.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		return stores
+	}
+	stores["postgres"] = func(t *testing.T) database.Store {
+		s, err := database.OpenPostgres(dbURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		if err := s.ClearUsers(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	return stores
+}
+
+// e2e runs commands the way main does, with a real config file in a temp dir
+type e2e struct {
+	t    *testing.T
+	s    *state
+	cmds *commands
+	// clock is the time agg ticks at, it starts at e2eBase
+	clock time.Time
+}
+
+func newE2E(t *testing.T, store database.Store) *e2e {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".gatorconfig.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(config.Options{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep fetches to the feed server quick
+	cfg.MinHostDelay = config.Duration(time.Millisecond)
+
+	cmds := &commands{handlers: make(map[string]commandInfo)}
+	registerCommands(cmds)
+	return &e2e{
+		t:     t,
+		s:     newState(&cfg, store),
+		cmds:  cmds,
+		clock: e2eBase,
+	}
+}
+
+// run runs a command line and returns what it printed
+func (e *e2e) run(args ...string) string {
+	e.t.Helper()
+	var err error
+	out := captureStdout(e.t, func() {
+		err = e.cmds.run(e.s, command{name: args[0], args: args[1:]})
+	})
+	if err != nil {
+		e.t.Fatalf("%s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// runErr runs a command line that is expected to fail, it returns what it
+// printed and the error
+func (e *e2e) runErr(args ...string) (string, error) {
+	e.t.Helper()
+	var err error
+	out := captureStdout(e.t, func() {
+		err = e.cmds.run(e.s, command{name: args[0], args: args[1:]})
+	})
+	if err == nil {
+		e.t.Fatalf("%s: expected an error", strings.Join(args, " "))
+	}
+	return out, err
+}
+
+// agg runs one tick of the agg loop and then moves the clock on by
+// tickEvery, a timeout above 0 bounds the fetch
+func (e *e2e) agg(timeout, tickEvery time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	scrapeFeeds(ctx, e.s, aggScope{followedOnly: true}, e.clock)
+	e.clock = e.clock.Add(tickEvery)
+}
+
+// storedTitles returns the titles of every post the current user can
+// browse, newest first
+func (e *e2e) storedTitles() []string {
+	e.t.Helper()
+	user, err := e.s.db.GetUser(context.Background(), e.s.cfg.CurrentUserName)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	posts, err := e.s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  1000,
+	})
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	titles := make([]string, 0, len(posts))
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+// e2eBase is a Sunday at noon
+var e2eBase = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEndToEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup serves the feeds and returns the paths to addfeed in order
+		setup func(srv *feedtest.Server) []string
+		// between changes the feeds after each tick
+		between func(srv *feedtest.Server, tick int)
+		ticks   int
+		// tickEvery is how far the clock moves on after each tick, 0 means a
+		// day so every feed is due again
+		tickEvery time.Duration
+		// timeout bounds each fetch, 0 means no timeout
+		timeout      time.Duration
+		maxBodyBytes config.ByteSize
+		wantTitles   []string
+		// wantFetchError is part of the error recorded on the first feed
+		wantFetchError string
+	}{
+		{
+			name: "rss feed",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.RSS("Blog",
+					feedtest.Item{Title: "one", GUID: "1", PubDate: e2eBase},
+					feedtest.Item{Title: "two", GUID: "2", PubDate: e2eBase.Add(time.Hour)},
+					feedtest.Item{Title: "three", GUID: "3", PubDate: e2eBase.Add(2 * time.Hour)},
+				))
+				return []string{"/rss"}
+			},
+			ticks:      1,
+			wantTitles: []string{"three", "two", "one"},
+		},
+		{
+			name: "real world rss fixture",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/blog.rss", feedtest.Fixture("blog.rss"))
+				return []string{"/blog.rss"}
+			},
+			ticks:      1,
+			wantTitles: []string{"The Green Tea Garbage Collector", "Testing Time (and other asynchronicities)", "Go 1.25 is released"},
+		},
+		{
+			name: "new and edited posts on later ticks",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.RSS("Blog",
+					feedtest.Item{Title: "one", GUID: "1", PubDate: e2eBase},
+				))
+				return []string{"/rss"}
+			},
+			between: func(srv *feedtest.Server, tick int) {
+				srv.Set("/rss", feedtest.RSS("Blog",
+					feedtest.Item{Title: "one edited", GUID: "1", PubDate: e2eBase},
+					feedtest.Item{Title: "two", GUID: "2", PubDate: e2eBase.Add(time.Hour)},
+				))
+			},
+			ticks:      3,
+			wantTitles: []string{"two", "one edited"},
+		},
+		{
+			name: "ttl delays the next fetch",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.WithChannel("<ttl>120</ttl>", feedtest.RSS("Blog",
+					feedtest.Item{Title: "one", GUID: "1", PubDate: e2eBase},
+				)))
+				return []string{"/rss"}
+			},
+			// The feed isn't due on the second tick, so "two" is never seen
+			between: func(srv *feedtest.Server, tick int) {
+				items := []feedtest.Item{{Title: "one", GUID: "1", PubDate: e2eBase}}
+				if tick == 0 {
+					items = append(items, feedtest.Item{Title: "two", GUID: "2", PubDate: e2eBase.Add(time.Hour)})
+				} else {
+					items = append(items, feedtest.Item{Title: "three", GUID: "3", PubDate: e2eBase.Add(2 * time.Hour)})
+				}
+				srv.Set("/rss", feedtest.WithChannel("<ttl>120</ttl>", feedtest.RSS("Blog", items...)))
+			},
+			ticks:      3,
+			tickEvery:  time.Hour,
+			wantTitles: []string{"three", "one"},
+		},
+		{
+			name: "skipDays waits for the next day",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.WithChannel("<skipDays><day>Sunday</day></skipDays>", feedtest.RSS("Blog",
+					feedtest.Item{Title: "one", GUID: "1", PubDate: e2eBase},
+				)))
+				return []string{"/rss"}
+			},
+			// Fetched Sunday noon, skipped Sunday evening, fetched again at
+			// midnight
+			between: func(srv *feedtest.Server, tick int) {
+				items := []feedtest.Item{{Title: "one", GUID: "1", PubDate: e2eBase}}
+				if tick == 0 {
+					items = append(items, feedtest.Item{Title: "two", GUID: "2", PubDate: e2eBase.Add(time.Hour)})
+				} else {
+					items = append(items, feedtest.Item{Title: "three", GUID: "3", PubDate: e2eBase.Add(2 * time.Hour)})
+				}
+				srv.Set("/rss", feedtest.WithChannel("<skipDays><day>Sunday</day></skipDays>", feedtest.RSS("Blog", items...)))
+			},
+			ticks:      3,
+			tickEvery:  6 * time.Hour,
+			wantTitles: []string{"three", "one"},
+		},
+		{
+			name: "redirect",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/old", feedtest.Redirect(http.StatusMovedPermanently, "/new"))
+				srv.Set("/new", feedtest.RSS("Blog", feedtest.Item{Title: "moved", GUID: "1", PubDate: e2eBase}))
+				return []string{"/old"}
+			},
+			ticks:      1,
+			wantTitles: []string{"moved"},
+		},
+		{
+			name: "server error",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.Status(http.StatusInternalServerError))
+				return []string{"/rss"}
+			},
+			ticks:          2,
+			wantTitles:     []string{},
+			wantFetchError: "unexpected status: 500",
+		},
+		{
+			name: "broken feed doesn't block the others",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/broken", feedtest.Status(http.StatusInternalServerError))
+				srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "fine", GUID: "1", PubDate: e2eBase}))
+				return []string{"/broken", "/rss"}
+			},
+			ticks:          2,
+			wantTitles:     []string{"fine"},
+			wantFetchError: "unexpected status: 500",
+		},
+		{
+			name: "malformed xml",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.Malformed())
+				return []string{"/rss"}
+			},
+			ticks:          1,
+			wantTitles:     []string{},
+			wantFetchError: "failed to parse the feed",
+		},
+		{
+			name: "slow feed within the timeout",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.Slow(50*time.Millisecond, feedtest.RSS("Blog", feedtest.Item{Title: "late", GUID: "1", PubDate: e2eBase})))
+				return []string{"/rss"}
+			},
+			ticks:      1,
+			timeout:    5 * time.Second,
+			wantTitles: []string{"late"},
+		},
+		{
+			name: "slow feed past the timeout",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/rss", feedtest.Slow(time.Minute, feedtest.RSS("Blog", feedtest.Item{Title: "too late", GUID: "1", PubDate: e2eBase})))
+				return []string{"/rss"}
+			},
+			ticks:          1,
+			timeout:        100 * time.Millisecond,
+			wantTitles:     []string{},
+			wantFetchError: "context deadline exceeded",
+		},
+		{
+			name: "huge body under the limit",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/huge", feedtest.Huge(4<<20))
+				return []string{"/huge"}
+			},
+			ticks:      1,
+			wantTitles: []string{"Huge post"},
+		},
+		{
+			name: "huge body over the limit",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/huge", feedtest.Huge(4<<20))
+				return []string{"/huge"}
+			},
+			ticks:          1,
+			maxBodyBytes:   1 << 20,
+			wantTitles:     []string{},
+			wantFetchError: "response body too large: more than 1048576 bytes",
+		},
+		{
+			name: "content length over the limit",
+			setup: func(srv *feedtest.Server) []string {
+				resp := feedtest.Huge(4 << 20)
+				resp.Headers = map[string]string{"Content-Length": fmt.Sprint(len(resp.Body) + 4<<20 + len(resp.Trailer))}
+				srv.Set("/huge", resp)
+				return []string{"/huge"}
+			},
+			ticks:          1,
+			maxBodyBytes:   1 << 20,
+			wantTitles:     []string{},
+			wantFetchError: "Content-Length is",
+		},
+		{
+			name: "body that never ends",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/endless", feedtest.Huge(1<<62))
+				return []string{"/endless"}
+			},
+			ticks:          1,
+			maxBodyBytes:   1 << 20,
+			wantTitles:     []string{},
+			wantFetchError: "response body too large",
+		},
+		{
+			name: "iso-8859-1 fixture is stored as utf-8",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/latin1", feedtest.Fixture("latin1.rss"))
+				return []string{"/latin1"}
+			},
+			ticks:      1,
+			wantTitles: []string{"Über Größe und Maß"},
+		},
+		{
+			// Only RSS is parsed, an Atom feed fails instead of reading as a
+			// feed with no posts
+			name: "atom fixture",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/atom", feedtest.Fixture("blog.atom"))
+				return []string{"/atom"}
+			},
+			ticks:          1,
+			wantTitles:     []string{},
+			wantFetchError: "unsupported feed format: the root element is <feed>",
+		},
+		{
+			name: "json feed fixture",
+			setup: func(srv *feedtest.Server) []string {
+				srv.Set("/json", feedtest.Fixture("blog.json"))
+				return []string{"/json"}
+			},
+			ticks:          1,
+			wantTitles:     []string{},
+			wantFetchError: "failed to parse the feed",
+		},
+	}
+
+	for storeName, newStore := range e2eStores(t) {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				srv := feedtest.NewServer(t)
+				paths := tt.setup(srv)
+
+				e := newE2E(t, newStore(t))
+				if tt.maxBodyBytes > 0 {
+					e.s.cfg.MaxBodyBytes = tt.maxBodyBytes
+				}
+				e.run("register", "alice")
+				for i, path := range paths {
+					e.run("addfeed", fmt.Sprintf("feed %d", i), srv.FeedURL(path))
+				}
+
+				tickEvery := tt.tickEvery
+				if tickEvery == 0 {
+					tickEvery = 24 * time.Hour
+				}
+				for tick := 0; tick < tt.ticks; tick++ {
+					e.agg(tt.timeout, tickEvery)
+					if tt.between != nil {
+						tt.between(srv, tick)
+					}
+				}
+
+				if got := e.storedTitles(); !slices.Equal(got, tt.wantTitles) {
+					t.Errorf("stored posts %q, want %q", got, tt.wantTitles)
+				}
+
+				feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL(paths[0]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(feed.LastFetchError.String, tt.wantFetchError) || feed.LastFetchError.Valid != (tt.wantFetchError != "") {
+					t.Errorf("last_fetch_error %v, want %q", feed.LastFetchError, tt.wantFetchError)
+				}
+
+				// The last fetch in the history has the same error
+				fetches, err := e.s.db.GetFeedFetches(context.Background(), database.GetFeedFetchesParams{FeedID: feed.ID, Limit: 1})
+				if err != nil || len(fetches) != 1 {
+					t.Fatalf("GetFeedFetches = %d fetches, %v, want 1", len(fetches), err)
+				}
+				if !strings.Contains(fetches[0].Error.String, tt.wantFetchError) || fetches[0].Error.Valid != (tt.wantFetchError != "") {
+					t.Errorf("feed_fetches error %v, want %q", fetches[0].Error, tt.wantFetchError)
+				}
+
+				// browse shows the same posts
+				out := e.run("browse", "1000")
+				for _, title := range tt.wantTitles {
+					if !strings.Contains(out, "* Title:         "+title+"\n") {
+						t.Errorf("browse output doesn't show %q:\n%s", title, out)
+					}
+				}
+				if len(tt.wantTitles) == 0 && !strings.Contains(out, "No posts found") {
+					t.Errorf("browse output %q, want no posts", out)
+				}
+			})
+		}
+	}
+}
+
+func TestEndToEndEditKeepsRevision(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "draft", GUID: "1", PubDate: e2eBase}))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "blog", srv.FeedURL("/rss"))
+	e.agg(0, time.Hour)
+
+	srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "final", GUID: "1", PubDate: e2eBase}))
+	e.agg(0, time.Hour)
+
+	// A third fetch of the same content changes nothing
+	e.agg(0, time.Hour)
+	if got := srv.Requests("/rss"); got != 3 {
+		t.Errorf("the feed was fetched %d times, want 3", got)
+	}
+
+	user, err := e.s.db.GetUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := e.s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("GetPostsForUser = %+v, %v, want one post", posts, err)
+	}
+
+	out := e.run("browse", "--history", posts[0].ID.String())
+	for _, want := range []string{"* Title:         final\n", "edited 1 times", "* Title:         draft\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("browse --history output doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestEndToEndLegacyPostGuids fetches a feed whose posts were saved before
+// guids were used, migration 007 gave them their raw link as guid. The SQLite
+// DB is put back before migration 016 so the migration finds them
+func TestEndToEndLegacyPostGuids(t *testing.T) {
+	const (
+		trackedLink = "HTTPS://Blog.example.com/tracked?utm_source=rss&id=1#top"
+		plainLink   = "https://blog.example.com/plain"
+	)
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.RSS("Blog",
+		feedtest.Item{Title: "tracked", Link: trackedLink, PubDate: e2eBase},
+		feedtest.Item{Title: "plain", Link: plainLink, PubDate: e2eBase.Add(-time.Hour)},
+	))
+
+	path := filepath.Join(t.TempDir(), "gator.db")
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newE2E(t, store)
+	e.run("register", "alice")
+	e.run("addfeed", "blog", srv.FeedURL("/rss"))
+	feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL("/rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved before content hashes and guids, the guid is the raw url
+	legacy, err := e.s.db.UpsertPosts(context.Background(), database.UpsertPostsParams{
+		Ids:           []uuid.UUID{uuid.New(), uuid.New()},
+		Titles:        []string{"tracked", "plain"},
+		Urls:          []string{trackedLink, plainLink},
+		Descriptions:  []string{"", ""},
+		PublishedAts:  []time.Time{e2eBase, e2eBase.Add(-time.Hour)},
+		Contents:      []string{"", ""},
+		Guids:         []string{trackedLink, plainLink},
+		Authors:       []string{"", ""},
+		ContentHashes: []string{"", ""},
+		Now:           e2eBase.Add(-24 * time.Hour),
+		FeedID:        feed.ID,
+	})
+	if err != nil || len(legacy) != 2 {
+		t.Fatalf("UpsertPosts = %+v, %v, want 2 posts", legacy, err)
+	}
+	store.Close()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first SQLite migration covers 001 to 008, so 016 is the ninth. The
+	// tables of the migrations after it are dropped too so they run again
+	for _, stmt := range []string{"DROP TABLE legacy_guid_feeds", "DROP TABLE post_reads", "PRAGMA user_version = 8"} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	// Opening the DB runs migration 016
+	store, err = sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	e.s.db = store
+
+	logs := captureLogs(t, func() { e.agg(0, time.Hour) })
+	if got := e.storedTitles(); !slices.Equal(got, []string{"tracked", "plain"}) {
+		t.Errorf("stored posts %q, want the legacy posts once each", got)
+	}
+	moved := false
+	for _, entry := range logs {
+		switch entry["msg"] {
+		case "feed fetch":
+			if entry["new_posts"] != float64(0) {
+				t.Errorf("the fetch saved %v new posts, want 0", entry["new_posts"])
+			}
+		case "moved legacy posts to their guid":
+			moved = true
+		}
+	}
+	if !moved {
+		t.Errorf("no legacy posts were moved, logs: %v", logs)
+	}
+
+	tracked := storedPost(t, e, "https://blog.example.com/tracked?id=1")
+	if tracked.ID != legacy[0].ID && tracked.ID != legacy[1].ID {
+		t.Errorf("the tracked post is %s, want a legacy post", tracked.ID)
+	}
+	if tracked.ContentHash == "" {
+		t.Errorf("the tracked post has no content hash, want it updated")
+	}
+	storedPost(t, e, plainLink)
+
+	// The feed is only fixed up once
+	logs = captureLogs(t, func() { e.agg(0, time.Hour) })
+	for _, entry := range logs {
+		if entry["msg"] == "moved legacy posts to their guid" {
+			t.Errorf("the second fetch moved legacy posts again")
+		}
+	}
+	if got := e.storedTitles(); len(got) != 2 {
+		t.Errorf("stored posts after the second fetch %q, want 2", got)
+	}
+}
+
+func TestEndToEndSetInterval(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.WithChannel("<ttl>60</ttl>", feedtest.RSS("Blog", feedtest.Item{Title: "one", GUID: "1", PubDate: e2eBase})))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "blog", srv.FeedURL("/rss"))
+
+	// The interval set by the user wins over the ttl
+	e.agg(0, time.Hour)
+	out := e.run("setinterval", srv.FeedURL("/rss"), "6h")
+	if !strings.Contains(out, "* Because:       set with setinterval\n") {
+		t.Errorf("setinterval output doesn't show the interval:\n%s", out)
+	}
+	for range 5 {
+		e.agg(0, time.Hour)
+	}
+	if got := srv.Requests("/rss"); got != 1 {
+		t.Errorf("the feed was fetched %d times in 6h, want 1", got)
+	}
+	e.agg(0, time.Hour)
+	if got := srv.Requests("/rss"); got != 2 {
+		t.Errorf("the feed was fetched %d times after 6h, want 2", got)
+	}
+
+	// default goes back to the ttl
+	out = e.run("setinterval", srv.FeedURL("/rss"), "default")
+	if !strings.Contains(out, "* Because:       feed ttl of 60 minutes\n") {
+		t.Errorf("setinterval default output doesn't show the ttl:\n%s", out)
+	}
+}
+
+func TestEndToEndAdaptiveSchedule(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	// A post every 4 hours, the last one just before the first tick
+	var busy []feedtest.Item
+	for i := range 5 {
+		busy = append(busy, feedtest.Item{Title: fmt.Sprint("busy ", i), GUID: fmt.Sprint(i), PubDate: e2eBase.Add(time.Duration(-4*i) * time.Hour)})
+	}
+	srv.Set("/busy", feedtest.RSS("Busy", busy...))
+	// Two posts a year ago
+	srv.Set("/dormant", feedtest.RSS("Dormant",
+		feedtest.Item{Title: "old", GUID: "1", PubDate: e2eBase.AddDate(-1, 0, 0)},
+		feedtest.Item{Title: "older", GUID: "2", PubDate: e2eBase.AddDate(-1, 0, -7)},
+	))
+	srv.Set("/new", feedtest.RSS("New"))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "busy", srv.FeedURL("/busy"))
+	e.run("addfeed", "dormant", srv.FeedURL("/dormant"))
+	e.run("addfeed", "new", srv.FeedURL("/new"))
+	for range 3 {
+		e.agg(0, 0)
+	}
+
+	for _, tt := range []struct {
+		path       string
+		wantNext   time.Duration
+		wantReason string
+	}{
+		{path: "/busy", wantNext: 2 * time.Hour, wantReason: "a post every 4h0m0s on average over the last 5 posts, fetching every 2h0m0s"},
+		{path: "/dormant", wantNext: 24 * time.Hour, wantReason: "capped at max_fetch_interval 24h0m0s"},
+		{path: "/new", wantNext: time.Hour, wantReason: "default_fetch_interval"},
+	} {
+		feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL(tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := feed.NextFetchAt.Time.Sub(e2eBase); got != tt.wantNext {
+			t.Errorf("%s is fetched again after %v, want %v", tt.path, got, tt.wantNext)
+		}
+		if !strings.Contains(feed.ScheduleReason.String, tt.wantReason) {
+			t.Errorf("%s schedule reason %q, want one containing %q", tt.path, feed.ScheduleReason.String, tt.wantReason)
+		}
+	}
+
+	// schedule lists them in the order they are fetched
+	out := e.run("schedule")
+	busyAt, newAt, dormantAt := strings.Index(out, "* Name:          busy\n"), strings.Index(out, "* Name:          new\n"), strings.Index(out, "* Name:          dormant\n")
+	if newAt < 0 || !(newAt < busyAt && busyAt < dormantAt) {
+		t.Errorf("schedule output isn't in fetch order new, busy, dormant:\n%s", out)
+	}
+	if !strings.Contains(out, "* Because:       no post for 365 days") {
+		t.Errorf("schedule output doesn't explain the dormant feed:\n%s", out)
+	}
+}
+
+func TestEndToEndAggOnce(t *testing.T) {
+	for name, newStore := range e2eStores(t) {
+		t.Run(name, func(t *testing.T) {
+			srv := feedtest.NewServer(t)
+			srv.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+			srv.Set("/broken", feedtest.Status(http.StatusInternalServerError))
+
+			e := newE2E(t, newStore(t))
+			e.run("register", "alice")
+			e.run("addfeed", "good", srv.FeedURL("/good"))
+
+			// A dry run fetches the feed but saves nothing
+			e.run("agg", "--dry-run")
+			if got := srv.Requests("/good"); got != 1 {
+				t.Errorf("the dry run fetched the feed %d times, want 1", got)
+			}
+			if got := e.storedTitles(); len(got) != 0 {
+				t.Errorf("the dry run stored %v, want nothing", got)
+			}
+			feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL("/good"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if feed.LastFetchedAt.Valid {
+				t.Errorf("the dry run marked the feed as fetched at %v", feed.LastFetchedAt.Time)
+			}
+
+			// Every due feed is fetched once, one failing fails the command
+			// but the others are still saved
+			e.run("addfeed", "broken", srv.FeedURL("/broken"))
+			_, err = e.runErr("agg", "--once")
+			if !strings.Contains(err.Error(), "Failed to fetch 1 of 2 feeds") {
+				t.Errorf("agg --once error %q, want one counting the failed feeds", err)
+			}
+			if got, want := e.storedTitles(), []string{"one", "two"}; !slices.Equal(got, want) {
+				t.Errorf("stored titles %v, want %v", got, want)
+			}
+
+			// Both were just fetched so nothing is due
+			events := captureLogs(t, func() { e.run("agg", "--once") })
+			if len(events) != 1 || events[0]["msg"] != "no feeds are due to be fetched" {
+				t.Errorf("agg --once logged %v, want that nothing is due", events)
+			}
+			if got := srv.Requests("/good"); got != 2 {
+				t.Errorf("the feed was fetched %d times, want 2", got)
+			}
+
+			// --once doesn't take a duration
+			if _, err := e.runErr("agg", "--once", "1m"); !strings.Contains(err.Error(), "usage: agg") {
+				t.Errorf("agg --once 1m error %q, want the usage", err)
+			}
+		})
+	}
+}
+
+func TestEndToEndFetch(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "Hello &amp; welcome", GUID: "1"}))
+
+	e := newE2E(t, memory.New())
+
+	out := e.run("fetch", srv.FeedURL("/rss"))
+	if !strings.Contains(out, "* Title: Hello & welcome\n") {
+		t.Errorf("fetch output doesn't list the titles:\n%s", out)
+	}
+
+	out = e.run("fetch", "--format", "json", srv.FeedURL("/rss"))
+	if !strings.Contains(out, `"Title": "Hello \u0026 welcome"`) {
+		t.Errorf("fetch --format json output isn't the feed as JSON:\n%s", out)
+	}
+
+	// A bad format fails before the feed is fetched
+	if _, err := e.runErr("fetch", "--format", "yaml", srv.FeedURL("/rss")); !strings.Contains(err.Error(), "Unknown format") {
+		t.Errorf("fetch --format yaml error %q, want an unknown format", err)
+	}
+	if got := srv.Requests("/rss"); got != 2 {
+		t.Errorf("the feed was fetched %d times, want 2", got)
+	}
+}
+
+func TestEndToEndAggScope(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	for _, path := range []string{"/alice", "/bob", "/orphan"} {
+		srv.Set(path, feedtest.RSS(path, feedtest.Item{Title: path, GUID: "1"}))
+	}
+
+	e := newE2E(t, memory.New())
+	e.run("register", "bob")
+	e.run("addfeed", "bob's", srv.FeedURL("/bob"))
+	e.run("register", "alice")
+	e.run("addfeed", "alice's", srv.FeedURL("/alice"))
+	e.run("addfeed", "orphan", srv.FeedURL("/orphan"))
+	e.run("unfollow", srv.FeedURL("/orphan"))
+
+	requests := func() []int {
+		return []int{srv.Requests("/alice"), srv.Requests("/bob"), srv.Requests("/orphan")}
+	}
+
+	// Only alice's feed
+	e.run("agg", "--once", "--only-user", "alice")
+	if got, want := requests(), []int{1, 0, 0}; !slices.Equal(got, want) {
+		t.Errorf("agg --only-user alice fetched %v times, want %v", got, want)
+	}
+
+	// Every followed feed, the orphan is left out
+	e.run("agg", "--once")
+	if got, want := requests(), []int{1, 1, 0}; !slices.Equal(got, want) {
+		t.Errorf("agg fetched %v times, want %v", got, want)
+	}
+
+	// Unless it is asked for
+	e.run("agg", "--once", "--followed-only=false")
+	if got, want := requests(), []int{1, 1, 1}; !slices.Equal(got, want) {
+		t.Errorf("agg --followed-only=false fetched %v times, want %v", got, want)
+	}
+
+	if _, err := e.runErr("agg", "--once", "--only-user", "carol"); !strings.Contains(err.Error(), "Failed to get user carol") {
+		t.Errorf("agg --only-user carol error %q, want an unknown user", err)
+	}
+}
+
+func TestEndToEndHistory(t *testing.T) {
+	for name, newStore := range e2eStores(t) {
+		t.Run(name, func(t *testing.T) {
+			srv := feedtest.NewServer(t)
+			srv.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+			srv.Set("/broken", feedtest.Status(http.StatusInternalServerError))
+
+			e := newE2E(t, newStore(t))
+			e.run("register", "alice")
+			e.run("addfeed", "good", srv.FeedURL("/good"))
+			e.run("addfeed", "broken", srv.FeedURL("/broken"))
+
+			if out := e.run("history", srv.FeedURL("/good")); !strings.Contains(out, "No fetches of") {
+				t.Errorf("history before agg printed %q, want that there are none", out)
+			}
+
+			// A dry run isn't recorded
+			e.runErr("agg", "--dry-run")
+			if out := e.run("history", srv.FeedURL("/good")); !strings.Contains(out, "No fetches of") {
+				t.Errorf("history after a dry run printed %q, want that there are none", out)
+			}
+
+			// agg fetches one due feed per tick, the broken feed waits its
+			// turn until the good one was fetched twice
+			e.run("unfollow", srv.FeedURL("/broken"))
+			e.agg(0, 2*time.Hour)
+			e.agg(0, 2*time.Hour)
+			e.run("follow", srv.FeedURL("/broken"))
+			e.agg(0, 2*time.Hour)
+
+			out := e.run("history", srv.FeedURL("/good"))
+			if got := strings.Count(out, "* Started:"); got != 2 {
+				t.Errorf("history shows %d fetches, want 2:\n%s", got, out)
+			}
+			for _, want := range []string{"* HTTP Status:   200", "* Items Parsed:  2", "* New Posts:     2", "* New Posts:     0"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("history is missing %q:\n%s", want, out)
+				}
+			}
+			// The newest fetch is first, it found nothing new
+			if strings.Index(out, "* New Posts:     0") > strings.Index(out, "* New Posts:     2") {
+				t.Errorf("history isn't newest first:\n%s", out)
+			}
+			if strings.Contains(out, "* Bytes:         0\n") {
+				t.Errorf("history shows no bytes read:\n%s", out)
+			}
+
+			out = e.run("history", "--limit", "1", srv.FeedURL("/broken"))
+			if got := strings.Count(out, "* Started:"); got != 1 {
+				t.Errorf("history --limit 1 shows %d fetches, want 1:\n%s", got, out)
+			}
+			for _, want := range []string{"* HTTP Status:   500", "* Items Parsed:  0", "* Error:"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("history of the broken feed is missing %q:\n%s", want, out)
+				}
+			}
+
+			// Fetches older than the retention are deleted as agg goes, the
+			// first fetch of the good feed is 6h old by its third
+			e.s.cfg.FetchHistoryRetention = config.Duration(5 * time.Hour)
+			e.agg(0, 2*time.Hour)
+			feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL("/good"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetches, err := e.s.db.GetFeedFetches(context.Background(), database.GetFeedFetchesParams{FeedID: feed.ID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fetches) != 2 {
+				t.Errorf("%d fetches are kept, want the 2 within the retention", len(fetches))
+			}
+
+			if _, err := e.runErr("history", "--limit", "0", srv.FeedURL("/good")); !strings.Contains(err.Error(), "Invalid limit") {
+				t.Errorf("history --limit 0 error %q, want an invalid limit", err)
+			}
+			if _, err := e.runErr("history", srv.FeedURL("/missing")); !strings.Contains(err.Error(), "not found") {
+				t.Errorf("history of an unknown feed error %q, want not found", err)
+			}
+		})
+	}
+}
+
+func TestEndToEndPrune(t *testing.T) {
+	for name, newStore := range e2eStores(t) {
+		t.Run(name, func(t *testing.T) {
+			srv := feedtest.NewServer(t)
+			// A post a day, "post 0" is the newest
+			var items []feedtest.Item
+			for i := range 5 {
+				items = append(items, feedtest.Item{Title: fmt.Sprint("post ", i), GUID: fmt.Sprint(i), PubDate: e2eBase.AddDate(0, 0, -i)})
+			}
+			srv.Set("/blog", feedtest.RSS("Blog", items...))
+
+			e := newE2E(t, newStore(t))
+			e.run("register", "alice")
+			e.run("addfeed", "blog", srv.FeedURL("/blog"))
+			e.agg(0, 24*time.Hour)
+
+			// Nothing is pruned until a retention is set
+			if out := e.run("prune"); !strings.Contains(out, "No posts to prune.") {
+				t.Errorf("prune without a retention printed %q, want nothing to prune", out)
+			}
+
+			// A starred post is kept
+			starred := storedPost(t, e, "3").ID.String()
+			if out := e.run("star", starred); !strings.Contains(out, "Starred post 3") {
+				t.Errorf("star printed %q, want post 3 starred", out)
+			}
+
+			// Nothing is pruned while alice hasn't read the posts, browse
+			// marks the posts it shows read
+			e.run("setretention", "--posts", "2", srv.FeedURL("/blog"))
+			if out := e.run("prune", "--dry-run"); !strings.Contains(out, "No posts to prune.") {
+				t.Errorf("prune of unread posts printed %q, want nothing to prune", out)
+			}
+			if out := e.run("browse", "5"); strings.Count(out, "* Starred:       yes") != 1 {
+				t.Errorf("browse marked %d posts as starred, want 1:\n%s", strings.Count(out, "* Starred:"), out)
+			}
+			unread := storedPost(t, e, "4").ID.String()
+			if out := e.run("unread", unread); !strings.Contains(out, "Marked post 4 unread") {
+				t.Errorf("unread printed %q, want post 4 unread", out)
+			}
+			if out := e.run("unread", unread); !strings.Contains(out, "post 4 is not read") {
+				t.Errorf("second unread printed %q, want post 4 not read", out)
+			}
+			if out := e.run("prune", "--dry-run"); !strings.Contains(out, "Would delete 1 posts of blog") {
+				t.Errorf("prune with post 4 unread printed %q, want only post 2 to delete", out)
+			}
+			if out := e.run("read", unread); !strings.Contains(out, "Marked post 4 read") {
+				t.Errorf("read printed %q, want post 4 read", out)
+			}
+
+			out := e.run("prune", "--dry-run")
+			if !strings.Contains(out, "Would delete 2 posts of blog, it keeps the newest 2 posts") {
+				t.Errorf("prune --dry-run printed %q, want the 2 posts it would delete", out)
+			}
+			if got := e.storedTitles(); len(got) != 5 {
+				t.Errorf("prune --dry-run left %v, want all 5 posts", got)
+			}
+
+			out = e.run("prune", srv.FeedURL("/blog"))
+			if !strings.Contains(out, "Deleted 2 posts in total.") {
+				t.Errorf("prune printed %q, want 2 posts deleted", out)
+			}
+			if got, want := e.storedTitles(), []string{"post 0", "post 1", "post 3"}; !slices.Equal(got, want) {
+				t.Errorf("titles after prune %v, want %v", got, want)
+			}
+
+			// The pruned posts are still in the feed but aren't saved again
+			logs := captureLogs(t, func() { e.agg(0, 24*time.Hour) })
+			if got, want := e.storedTitles(), []string{"post 0", "post 1", "post 3"}; !slices.Equal(got, want) {
+				t.Errorf("titles after fetching the pruned posts %v, want %v", got, want)
+			}
+			fetched := false
+			for _, entry := range logs {
+				if entry["msg"] == "feed fetch" {
+					fetched = true
+					if entry["new_posts"] != float64(0) {
+						t.Errorf("the fetch saved %v new posts, want 0", entry["new_posts"])
+					}
+				}
+			}
+			if !fetched {
+				t.Errorf("agg didn't fetch the feed, logs: %v", logs)
+			}
+
+			// Without flags the feed goes back to the global settings, which
+			// agg applies after each fetch
+			out = e.run("setretention", srv.FeedURL("/blog"))
+			if !strings.Contains(out, "* Keeps Posts:   forever") {
+				t.Errorf("setretention without flags printed %q, want it to keep posts forever", out)
+			}
+			e.s.cfg.PostRetentionPosts = 1
+			srv.Set("/blog", feedtest.RSS("Blog", feedtest.Item{Title: "new", GUID: "new", PubDate: e.clock}))
+			e.agg(0, 0)
+			if got, want := e.storedTitles(), []string{"new", "post 3"}; !slices.Equal(got, want) {
+				t.Errorf("titles after agg %v, want %v", got, want)
+			}
+
+			// Once unstarred it is pruned like any other post
+			if out := e.run("unstar", starred); !strings.Contains(out, "Unstarred post 3") {
+				t.Errorf("unstar printed %q, want post 3 unstarred", out)
+			}
+			if out := e.run("unstar", starred); !strings.Contains(out, "post 3 is not starred") {
+				t.Errorf("second unstar printed %q, want post 3 not starred", out)
+			}
+			e.run("prune")
+			if got, want := e.storedTitles(), []string{"new"}; !slices.Equal(got, want) {
+				t.Errorf("titles after unstar and prune %v, want %v", got, want)
+			}
+
+			if _, err := e.runErr("setretention", "--days", "-1", srv.FeedURL("/blog")); !strings.Contains(err.Error(), "Invalid --days") {
+				t.Errorf("setretention --days -1 error %q, want an invalid days", err)
+			}
+		})
+	}
+}
@@ -3,14 +3,15 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jcourtney5/blog-aggregator/internal/database"
-	"github.com/lib/pq"
 )
 
 // example feeds
@@ -19,108 +20,365 @@ import (
 // go run . addfeed 'Boot.dev Blog' https://blog.boot.dev/index.xml
 
 func handlerAgg(s *state, cmd command) error {
-	// Make sure there is enough args
-	if len(cmd.args) < 1 || len(cmd.args) > 2 {
-		return fmt.Errorf("usage: %v <time_between_requests>", cmd.name)
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	once := fs.Bool("once", false, "fetch every due feed once and exit")
+	dryRun := fs.Bool("dry-run", false, "fetch and parse the due feeds without saving anything")
+	onlyUser := fs.String("only-user", "", "only fetch the feeds this user follows")
+	followedOnly := fs.Bool("followed-only", true, "leave out the feeds nobody follows")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address")
+	healthAddr := fs.String("health-addr", "", "serve /healthz, /readyz and a status page on this address")
+	readyIntervals := fs.Int("ready-intervals", 3, "agg is ready while its last cycle completed within this many intervals")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
 	}
 
-	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
-	if err != nil {
-		return fmt.Errorf("unable to parse duration: %w\n", err)
+	scope := aggScope{followedOnly: *followedOnly}
+	if *onlyUser != "" {
+		user, err := s.db.GetUser(context.Background(), *onlyUser)
+		if err != nil {
+			return fmt.Errorf("Failed to get user %s: %w\n", *onlyUser, err)
+		}
+		scope.userID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	}
+
+	if *metricsAddr != "" {
+		addr, err := serveMetrics(s.metrics, *metricsAddr)
+		if err != nil {
+			return fmt.Errorf("Failed to serve metrics on %s: %w\n", *metricsAddr, err)
+		}
+		slog.Info("serving metrics", "url", fmt.Sprintf("http://%v/metrics", addr))
+	}
+
+	// A dry run saves nothing so the same feeds would stay due on every
+	// tick, it is always a single pass
+	singlePass := *once || *dryRun
+	var timeBetweenRequests time.Duration
+	if singlePass {
+		if len(args) > 0 {
+			return cmd.usageError()
+		}
+	} else {
+		// Make sure there is enough args
+		if len(args) != 1 {
+			return cmd.usageError()
+		}
+		timeBetweenRequests, err = time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("unable to parse duration: %w\n", err)
+		}
+	}
+	if *readyIntervals <= 0 {
+		return fmt.Errorf("--ready-intervals must be at least 1\n")
+	}
+
+	if *healthAddr != "" {
+		addr, err := serveHTTP(*healthAddr, newHealthMux(s, time.Duration(*readyIntervals)*timeBetweenRequests))
+		if err != nil {
+			return fmt.Errorf("Failed to serve health checks on %s: %w\n", *healthAddr, err)
+		}
+		slog.Info("serving health checks", "url", fmt.Sprintf("http://%v/", addr))
+	}
+
+	if singlePass {
+		return aggOnce(context.Background(), s, scope, *dryRun)
 	}
 
-	fmt.Printf("Collecting Feeds Every %v\n", timeBetweenRequests)
+	slog.Info("checking for due feeds", "every", timeBetweenRequests, "only_user", *onlyUser, "followed_only", *followedOnly)
 
 	ticker := time.NewTicker(timeBetweenRequests)
 	for ; ; <-ticker.C {
-		scrapeFeeds(s)
+		scrapeFeeds(context.Background(), s, scope, time.Now().UTC())
+	}
+}
+
+// aggScope is which feeds agg fetches
+type aggScope struct {
+	// followedOnly leaves out the feeds nobody follows, nobody would read
+	// their posts
+	followedOnly bool
+	// userID limits agg to the feeds one user follows
+	userID uuid.NullUUID
+}
+
+// nextFeed returns the feed in the scope that has been due the longest
+func (scope aggScope) nextFeed(ctx context.Context, q database.Querier, now time.Time) (database.Feed, error) {
+	switch {
+	case scope.userID.Valid:
+		return q.GetNextUserFeedToFetch(ctx, database.GetNextUserFeedToFetchParams{UserID: scope.userID.UUID, Now: now})
+	case scope.followedOnly:
+		return q.GetNextFollowedFeedToFetch(ctx, now)
+	}
+	return q.GetNextFeedToFetch(ctx, now)
+}
+
+// dueFeeds returns every feed in the scope that is due
+func (scope aggScope) dueFeeds(ctx context.Context, q database.Querier, now time.Time) ([]database.Feed, error) {
+	switch {
+	case scope.userID.Valid:
+		return q.GetUserFeedsToFetch(ctx, database.GetUserFeedsToFetchParams{UserID: scope.userID.UUID, Now: now})
+	case scope.followedOnly:
+		return q.GetFollowedFeedsToFetch(ctx, now)
+	}
+	return q.GetFeedsToFetch(ctx, now)
+}
+
+// aggOnce fetches every feed in the scope that is due now one time, the
+// error says how many of them failed
+func aggOnce(ctx context.Context, s *state, scope aggScope, dryRun bool) error {
+	feeds, err := scope.dueFeeds(ctx, s.db, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("Failed to get the feeds to fetch: %w\n", err)
+	}
+
+	if len(feeds) == 0 {
+		endCycle(ctx, s, scope, time.Now().UTC(), true)
+		slog.Info("no feeds are due to be fetched")
+		return nil
 	}
 
+	failed := 0
+	for _, feed := range feeds {
+		if err := scrapeFeed(ctx, s, feed, time.Now().UTC(), dryRun); err != nil {
+			failed++
+		}
+	}
+	endCycle(ctx, s, scope, time.Now().UTC(), failed == 0)
+	if failed > 0 {
+		return fmt.Errorf("Failed to fetch %d of %d feeds\n", failed, len(feeds))
+	}
+
+	slog.Info("fetched every due feed", "feeds", len(feeds))
 	return nil
 }
 
-func scrapeFeeds(s *state) {
+// scrapeFeeds fetches the feed in the scope that has been due the longest
+// at now and saves its posts, it is one tick of the agg loop
+func scrapeFeeds(ctx context.Context, s *state, scope aggScope, now time.Time) {
 	// get the next feed to fetch
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
+	feed, err := scope.nextFeed(ctx, s.db, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("no feeds are due to be fetched")
+		endCycle(ctx, s, scope, now, true)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to get next feed to fetch: %v\n", err)
+		slog.Error("failed to get the next feed to fetch", "error", err)
 		return
 	}
 
-	log.Printf("Next feed to fetch is:\n")
-	log.Printf("* Name:          %s\n", feed.Name)
-	log.Printf("* URL:           %s\n", feed.Url)
-	log.Println("=========================================")
+	err = scrapeFeed(ctx, s, feed, now, false)
+	endCycle(ctx, s, scope, now, err == nil)
+}
 
-	// fetch the feed
-	rssFeed, err := fetchFeed(context.Background(), feed.Url)
+// endCycle updates the metrics at the end of a cycle of agg, the feeds that
+// are still due at now are overdue
+func endCycle(ctx context.Context, s *state, scope aggScope, now time.Time, succeeded bool) {
+	s.status.endCycle()
+	if succeeded {
+		s.metrics.lastSuccessCycle.Set(float64(now.Unix()))
+	}
+	due, err := scope.dueFeeds(ctx, s.db, now)
 	if err != nil {
-		log.Printf("Failed to fetch RSS feed %s: %v\n", feed.Name, err)
+		slog.Error("failed to count the overdue feeds", "error", err)
 		return
 	}
+	s.metrics.feedsOverdue.Set(float64(len(due)))
+}
+
+// scrapeFeed fetches one feed at now and saves its posts, a dry run only
+// fetches and parses it. Every fetch is logged as one event
+func scrapeFeed(ctx context.Context, s *state, feed database.Feed, now time.Time, dryRun bool) error {
+	event := fetchEvent{feed: feed, now: now, start: time.Now(), dryRun: dryRun}
+	s.status.startFetch(event)
 
-	// Save the posts
-	for _, item := range rssFeed.Channel.Item {
-		// parse the publishedAt time
-		publishedAt := sql.NullTime{}
-		parsedTime, err := time.Parse(time.RFC1123Z, item.PubDate)
-		if err == nil {
-			publishedAt = sql.NullTime{Time: parsedTime, Valid: true}
-		} else {
-			log.Printf("Failed to parse published at %s: %v\n", item.PubDate, err)
+	// fetch the feed
+	rssFeed, stats, err := fetchFeedWithStats(ctx, s, feed.Url)
+	event.stats = stats
+	if err != nil {
+		event.status, event.err = fetchOutcome(err), err
+		recordFetch(ctx, s, event)
+		if dryRun {
+			return err
 		}
 
-		_, err = s.db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now().UTC(),
-			UpdatedAt:   time.Now().UTC(),
-			Title:       item.Title,
-			Url:         item.Link,
-			Description: sql.NullString{String: item.Description, Valid: true},
-			PublishedAt: publishedAt,
-			FeedID:      feed.ID,
+		// Still mark the feed as fetched so a broken feed waits for its next
+		// fetch instead of being retried on every tick, the error is kept
+		// on the feed for the feeds command. It is saved even if ctx is what
+		// stopped the fetch
+		fetchErr := err
+		saveCtx := context.WithoutCancel(ctx)
+		next, reason, err := scheduleNextFetch(saveCtx, s.db, s.cfg, feed, now)
+		if err != nil {
+			slog.Error("failed to schedule the feed", "feed_id", feed.ID, "error", err)
+			return fetchErr
+		}
+		_, err = s.db.MarkFeedFetchFailed(saveCtx, database.MarkFeedFetchFailedParams{
+			ID:             feed.ID,
+			UpdatedAt:      now,
+			LastFetchedAt:  sql.NullTime{Time: now, Valid: true},
+			LastFetchError: sql.NullString{String: fetchErr.Error(), Valid: true},
+			NextFetchAt:    sql.NullTime{Time: next, Valid: true},
+			ScheduleReason: sql.NullString{String: "last fetch failed, " + reason, Valid: true},
 		})
 		if err != nil {
-			// Only log an error if didn't fail unique constraint
-			if pgerr, ok := err.(*pq.Error); ok {
-				if pgerr.Code != "23505" {
-					log.Printf("Failed to save post: %v\n", err)
-				}
-			}
+			slog.Error("failed to mark the feed as fetched", "feed_id", feed.ID, "error", err)
 		}
+		return fetchErr
+	}
+	event.posts = len(rssFeed.Channel.Item)
+
+	if dryRun {
+		event.status = outcomeOK
+		recordFetch(ctx, s, event)
+		return nil
 	}
 
-	// mark feed as fetched
-	_, err = s.db.MarkFeedFetched(context.Background(), database.MarkFeedFetchedParams{
-		ID:            feed.ID,
-		UpdatedAt:     time.Now().UTC(),
-		LastFetchedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	// The next fetch is scheduled with what the feed says about itself now
+	feed.Ttl = parseTTL(rssFeed.Channel.TTL)
+	feed.SkipHours = skipHoursMask(rssFeed.Channel.SkipHours)
+	feed.SkipDays = skipDaysMask(rssFeed.Channel.SkipDays)
+
+	// Save the posts and mark the feed as fetched in one transaction, so a
+	// crash never leaves a half saved feed behind
+	var result savePostsResult
+	var next time.Time
+	err = s.db.ExecTx(ctx, func(q database.Querier) error {
+		result, err = savePosts(ctx, q, feed.ID, rssFeed.Channel.Item, postBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to save posts: %w", err)
+		}
+
+		// Schedule after saving so the new posts count towards the cadence
+		var reason string
+		next, reason, err = scheduleNextFetch(ctx, q, s.cfg, feed, now)
+		if err != nil {
+			return fmt.Errorf("failed to schedule the next fetch: %w", err)
+		}
+
+		// mark feed as fetched
+		_, err = q.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID:             feed.ID,
+			UpdatedAt:      now,
+			LastFetchedAt:  sql.NullTime{Time: now, Valid: true},
+			NextFetchAt:    sql.NullTime{Time: next, Valid: true},
+			Ttl:            feed.Ttl,
+			SkipHours:      feed.SkipHours,
+			SkipDays:       feed.SkipDays,
+			ScheduleReason: sql.NullString{String: reason, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark feed as fetched: %w", err)
+		}
+		return nil
 	})
 	if err != nil {
-		log.Printf("Failed to mark feed %s as fetched: %v\n", feed.Name, err)
+		event.status, event.err = outcomeSaveFailed, err
+		recordFetch(ctx, s, event)
+		return err
 	}
 
-	log.Printf("Feed %s collected, %v posts found\n", feed.Name, len(rssFeed.Channel.Item))
-}
+	event.status, event.result, event.next = outcomeOK, result, next
+	recordFetch(ctx, s, event)
 
-func print_rss_feed(rssFeed *RSSFeed) error {
-	fmt.Printf("%+v\n", rssFeed)
+	// Keep the feed within its retention now that it has new posts, a
+	// failure is only logged since the fetch itself worked
+	pruned, err := prunePosts(ctx, s.db, s.cfg, feed, time.Now().UTC(), false)
+	if err != nil {
+		slog.Error("failed to prune posts", "feed_id", feed.ID, "error", err)
+	} else if pruned > 0 {
+		slog.Info("pruned posts", "feed_id", feed.ID, "feed", feed.Name, "posts", pruned, "retention", feedRetention(s.cfg, feed).String())
+	}
 	return nil
 }
 
-func print_rss_feed_json_formatted(rssFeed *RSSFeed) error {
-	// print formatted JSON
-	formattedJSON, err := json.MarshalIndent(rssFeed, "", "  ")
-	if err != nil {
-		return err
+// fetchEvent is what happened in one fetch of a feed
+type fetchEvent struct {
+	feed database.Feed
+	// now is the time agg fetched the feed at, start the wall clock time
+	// the fetch took is measured from
+	now    time.Time
+	start  time.Time
+	dryRun bool
+	stats  fetchStats
+	// status is one of the outcome labels of the fetch metrics
+	status string
+	// posts is how many posts the feed has, result how many were saved
+	posts  int
+	result savePostsResult
+	next   time.Time
+	err    error
+	// end is set when the fetch is added to the status page
+	end time.Time
+}
+
+// recordFetch logs a fetch as one event, counts it in the metrics, adds it
+// to the status page and saves it in the history of the feed
+func recordFetch(ctx context.Context, s *state, event fetchEvent) {
+	duration := time.Since(event.start)
+	s.status.finishFetch(event)
+	if !event.dryRun {
+		saveFetchHistory(context.WithoutCancel(ctx), s, event, duration)
 	}
-	fmt.Println(string(formattedJSON))
-	return nil
+	s.metrics.fetches.WithLabelValues(event.status).Inc()
+	if event.status == outcomeOK && !event.dryRun {
+		s.metrics.savedPosts(event.posts, event.result)
+	}
+
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("feed_id", event.feed.ID.String()),
+		slog.String("feed", event.feed.Name),
+		slog.String("url", event.feed.Url),
+		slog.Duration("duration", duration),
+		slog.String("status", event.status),
+		slog.Int("posts", event.posts),
+		slog.Int("new_posts", event.result.inserted),
+		slog.Int("updated_posts", event.result.updated),
+	}
+	if event.dryRun {
+		attrs = append(attrs, slog.Bool("dry_run", true))
+	}
+	if event.stats.status != 0 {
+		attrs = append(attrs, slog.Int("http_status", event.stats.status))
+	}
+	if !event.next.IsZero() {
+		attrs = append(attrs, slog.Time("next_fetch_at", event.next))
+	}
+	if event.err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", event.err.Error()))
+	}
+	slog.LogAttrs(ctx, level, "feed fetch", attrs...)
 }
 
-func print_rss_feed_titles(rssFeed *RSSFeed) error {
-	for _, item := range rssFeed.Channel.Item {
-		fmt.Printf("* Title: %s\n", item.Title)
+// saveFetchHistory adds a fetch to the feed_fetches table and deletes the
+// fetches older than fetch_history_retention
+func saveFetchHistory(ctx context.Context, s *state, event fetchEvent, duration time.Duration) {
+	fetch := database.CreateFeedFetchParams{
+		ID:            uuid.New(),
+		FeedID:        event.feed.ID,
+		StartedAt:     event.now,
+		DurationMs:    int32(min(duration.Milliseconds(), math.MaxInt32)),
+		HttpStatus:    sql.NullInt32{Int32: int32(event.stats.status), Valid: event.stats.status != 0},
+		Bytes:         event.stats.bytes,
+		ItemsParsed:   int32(event.posts),
+		PostsInserted: int32(event.result.inserted),
+	}
+	if event.err != nil {
+		fetch.Error = sql.NullString{String: event.err.Error(), Valid: true}
+	}
+	if err := s.db.CreateFeedFetch(ctx, fetch); err != nil {
+		slog.Error("failed to save the fetch history", "feed_id", event.feed.ID, "error", err)
+	}
+
+	retention := time.Duration(s.cfg.FetchHistoryRetention)
+	deleted, err := s.db.DeleteFeedFetchesBefore(ctx, event.now.Add(-retention))
+	if err != nil {
+		slog.Error("failed to delete the old fetch history", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Debug("deleted old fetch history", "fetches", deleted, "retention", retention)
 	}
-	return nil
 }
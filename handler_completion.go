@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// handlerCompletion returns the completion command, the scripts are generated
+// from the registered commands so they never get out of date
+func handlerCompletion(cmds *commands) func(*state, command) error {
+	return func(s *state, cmd command) error {
+		if len(cmd.args) != 1 {
+			return cmd.usageError()
+		}
+
+		switch cmd.args[0] {
+		case "bash":
+			fmt.Print(bashCompletion(cmds))
+		case "zsh":
+			fmt.Print(zshCompletion(cmds))
+		case "fish":
+			fmt.Print(fishCompletion(cmds))
+		default:
+			return cmd.usageError()
+		}
+		return nil
+	}
+}
+
+// firstArgChoices returns the fixed values the first arg of a command can
+// take, args like feed URLs depend on the DB and aren't completed by scripts
+func firstArgChoices(cmds *commands, info commandInfo) []string {
+	if len(info.subcommands) > 0 {
+		names := make([]string, 0, len(info.subcommands))
+		for _, sub := range info.subcommands {
+			names = append(names, sub.name)
+		}
+		return names
+	}
+	if len(info.args) == 0 {
+		return nil
+	}
+	switch info.args[0].kind {
+	case argCommand:
+		return cmds.names
+	case argShell:
+		return completionShells
+	}
+	return nil
+}
+
+// commandFlagNames returns the flags of a command as "--name"
+func commandFlagNames(info commandInfo) []string {
+	names := make([]string, 0, len(info.flags))
+	for _, f := range info.flags {
+		names = append(names, "--"+f.name)
+	}
+	return names
+}
+
+// globalFlagList returns the global flags in the order they are defined
+func globalFlagList() []*flag.Flag {
+	var flags []*flag.Flag
+	newGlobalFlags().fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+// completionFuncName turns the program name into a valid shell identifier
+func completionFuncName() string {
+	return "_" + regexp.MustCompile(`[^A-Za-z0-9_]`).ReplaceAllString(programName(), "_")
+}
+
+func bashCompletion(cmds *commands) string {
+	var b strings.Builder
+	name := programName()
+	funcName := completionFuncName()
+
+	var flagNames []string
+	for _, f := range globalFlagList() {
+		flagNames = append(flagNames, "--"+f.Name)
+	}
+
+	fmt.Fprintf(&b, "# bash completion for %s, generated by \"%s completion bash\"\n", name, name)
+	fmt.Fprintf(&b, "%s() {\n", funcName)
+	b.WriteString("    local cur cmd i\n")
+	b.WriteString("    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    cmd=\"\"\n")
+	b.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("        case \"${COMP_WORDS[i]}\" in\n")
+	fmt.Fprintf(&b, "            %s) ((i++)) ;;\n", strings.Join(flagNames, "|"))
+	b.WriteString("            -*) ;;\n")
+	b.WriteString("            *) cmd=\"${COMP_WORDS[i]}\"; break ;;\n")
+	b.WriteString("        esac\n")
+	b.WriteString("    done\n")
+	b.WriteString("    if [[ -z \"$cmd\" ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s %s\" -- \"$cur\"))\n", strings.Join(flagNames, " "), strings.Join(cmds.names, " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+	b.WriteString("        case \"$cmd\" in\n")
+	for _, info := range cmds.list() {
+		if flags := commandFlagNames(info); len(flags) > 0 {
+			fmt.Fprintf(&b, "            %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", info.name, strings.Join(flags, " "))
+		}
+	}
+	b.WriteString("        esac\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    if ((COMP_CWORD - i != 1)); then\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"$cmd\" in\n")
+	for _, info := range cmds.list() {
+		if choices := firstArgChoices(cmds, info); len(choices) > 0 {
+			fmt.Fprintf(&b, "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", info.name, strings.Join(choices, " "))
+		}
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", funcName, name)
+	return b.String()
+}
+
+func zshCompletion(cmds *commands) string {
+	var b strings.Builder
+	name := programName()
+	funcName := completionFuncName()
+
+	fmt.Fprintf(&b, "#compdef %s\n", name)
+	fmt.Fprintf(&b, "# zsh completion for %s, generated by \"%s completion zsh\"\n", name, name)
+	fmt.Fprintf(&b, "%s() {\n", funcName)
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, info := range cmds.list() {
+		fmt.Fprintf(&b, "        %s\n", zshQuote(info.name+":"+info.description))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    local state line\n")
+	b.WriteString("    _arguments -C \\\n")
+	for _, f := range globalFlagList() {
+		fmt.Fprintf(&b, "        %s \\\n", zshQuote("--"+f.Name+"["+zshEscapeBrackets(f.Usage)+"]:"+f.Name+":"))
+	}
+	b.WriteString("        '1: :->command' \\\n")
+	b.WriteString("        '*:: :->args'\n")
+	b.WriteString("    case $state in\n")
+	b.WriteString("        command) _describe 'command' commands ;;\n")
+	b.WriteString("        args)\n")
+	b.WriteString("            if [[ $words[CURRENT] == -* ]]; then\n")
+	b.WriteString("                case $line[1] in\n")
+	for _, info := range cmds.list() {
+		if flags := commandFlagNames(info); len(flags) > 0 {
+			fmt.Fprintf(&b, "                    %s) compadd -- %s ;;\n", info.name, strings.Join(flags, " "))
+		}
+	}
+	b.WriteString("                esac\n")
+	b.WriteString("                return\n")
+	b.WriteString("            fi\n")
+	b.WriteString("            (( CURRENT == 2 )) || return\n")
+	b.WriteString("            case $line[1] in\n")
+	for _, info := range cmds.list() {
+		var values []string
+		if len(info.subcommands) > 0 {
+			for _, sub := range info.subcommands {
+				values = append(values, zshQuote(sub.name+"["+zshEscapeBrackets(sub.description)+"]"))
+			}
+		} else {
+			for _, choice := range firstArgChoices(cmds, info) {
+				values = append(values, zshQuote(choice))
+			}
+		}
+		if len(values) > 0 {
+			fmt.Fprintf(&b, "                %s) _values '%s' %s ;;\n", info.name, info.name, strings.Join(values, " "))
+		}
+	}
+	b.WriteString("            esac\n")
+	b.WriteString("            ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "compdef %s %s\n", funcName, name)
+	return b.String()
+}
+
+func fishCompletion(cmds *commands) string {
+	var b strings.Builder
+	name := programName()
+
+	fmt.Fprintf(&b, "# fish completion for %s, generated by \"%s completion fish\"\n", name, name)
+	fmt.Fprintf(&b, "complete -c %s -f\n", name)
+	for _, f := range globalFlagList() {
+		fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -l %s -r -d %s\n", name, f.Name, fishQuote(f.Usage))
+	}
+	for _, info := range cmds.list() {
+		fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", name, info.name, fishQuote(info.description))
+	}
+	for _, info := range cmds.list() {
+		for _, f := range info.flags {
+			requiresValue := ""
+			if f.value != "" {
+				requiresValue = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c %s -n %s -l %s%s -d %s\n", name, fishQuote("__fish_seen_subcommand_from "+info.name), f.name, requiresValue, fishQuote(f.description))
+		}
+	}
+	for _, info := range cmds.list() {
+		choices := firstArgChoices(cmds, info)
+		if len(choices) == 0 {
+			continue
+		}
+		// Stop completing once one of the choices has been given, the command
+		// name itself is left out since help can complete its own name
+		var others []string
+		for _, choice := range choices {
+			if choice != info.name {
+				others = append(others, choice)
+			}
+		}
+		condition := fmt.Sprintf("__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s", info.name, strings.Join(others, " "))
+		if len(info.subcommands) > 0 {
+			for _, sub := range info.subcommands {
+				fmt.Fprintf(&b, "complete -c %s -n %s -a %s -d %s\n", name, fishQuote(condition), sub.name, fishQuote(sub.description))
+			}
+		} else {
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s\n", name, fishQuote(condition), fishQuote(strings.Join(choices, " ")))
+		}
+	}
+	return b.String()
+}
+
+// zshQuote single quotes a word for zsh
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscapeBrackets escapes the brackets in descriptions used by _arguments
+// and _values
+func zshEscapeBrackets(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// fishQuote single quotes a word for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	e := newE2E(t, memory.New())
+
+	tests := []struct {
+		shell  string
+		script func(*commands) string
+		// hasCommand reports whether the script completes a command name,
+		// flag returns what the script has for each flag of a command
+		hasCommand func(script string, info commandInfo) bool
+		flag       func(flagSpec) string
+	}{
+		{
+			shell:  "bash",
+			script: bashCompletion,
+			hasCommand: func(script string, info commandInfo) bool {
+				// The first word list has the global flags and the commands
+				_, words, _ := strings.Cut(script, `compgen -W "`)
+				words, _, _ = strings.Cut(words, `"`)
+				return slices.Contains(strings.Fields(words), info.name)
+			},
+			flag: func(f flagSpec) string { return "--" + f.name },
+		},
+		{
+			shell:  "zsh",
+			script: zshCompletion,
+			hasCommand: func(script string, info commandInfo) bool {
+				return strings.Contains(script, zshQuote(info.name+":"+info.description))
+			},
+			flag: func(f flagSpec) string { return "--" + f.name },
+		},
+		{
+			shell:  "fish",
+			script: fishCompletion,
+			hasCommand: func(script string, info commandInfo) bool {
+				return strings.Contains(script, "__fish_use_subcommand -a "+info.name+" ")
+			},
+			flag: func(f flagSpec) string { return "-l " + f.name },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			script := tt.script(e.cmds)
+			if out := e.run("completion", tt.shell); out != script {
+				t.Errorf("completion %s printed a different script than it generates", tt.shell)
+			}
+
+			for _, info := range e.cmds.list() {
+				if !tt.hasCommand(script, info) {
+					t.Errorf("%s script is missing the command %s", tt.shell, info.name)
+				}
+				for _, f := range info.flags {
+					if !strings.Contains(script, tt.flag(f)) {
+						t.Errorf("%s script is missing the flag --%s of %s", tt.shell, f.name, info.name)
+					}
+				}
+				for _, sub := range info.subcommands {
+					if !strings.Contains(script, sub.name) {
+						t.Errorf("%s script is missing the subcommand %s of %s", tt.shell, sub.name, info.name)
+					}
+				}
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"completion", "tcsh"}, {"completion"}, {"completion", "bash", "zsh"}} {
+		if _, err := e.runErr(args...); !strings.Contains(err.Error(), "usage: completion") {
+			t.Errorf("%s error = %q, want the usage", strings.Join(args, " "), err)
+		}
+	}
+}
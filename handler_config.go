@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+)
+
+func handlerConfig(s *state, cmd command) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 1 || cmd.args[0] != "show" {
+		return cmd.usageError()
+	}
+
+	fmt.Printf("Config file: %s\n", s.cfg.Path())
+	for _, setting := range s.cfg.Settings() {
+		fmt.Printf("* %-18s %-40s (%s)\n", setting.Key+":", setting.Value, setting.Source)
+	}
+
+	return nil
+}
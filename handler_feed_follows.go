@@ -12,7 +12,7 @@ import (
 func handlerFollow(s *state, cmd command, user database.User) error {
 	// Make sure there is enough args
 	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %v <url>", cmd.name)
+		return cmd.usageError()
 	}
 
 	// Get the args
@@ -66,7 +66,7 @@ func handlerListFeedFollows(s *state, cmd command, user database.User) error {
 func handlerRemoveFollow(s *state, cmd command, user database.User) error {
 	// Make sure there is enough args
 	if len(cmd.args) < 1 {
-		return fmt.Errorf("usage: %v <url>", cmd.name)
+		return cmd.usageError()
 	}
 
 	// Get the args
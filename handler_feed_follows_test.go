@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHandlerFollow(t *testing.T) {
+	const feedURL = "https://example.com/rss"
+
+	tests := []struct {
+		name          string
+		args          []string
+		alreadyFollow bool
+		wantErr       string
+		wantFollows   int
+	}{
+		{name: "no args", wantErr: "usage"},
+		{name: "unknown feed", args: []string{"https://example.com/missing"}, wantErr: "not found"},
+		{name: "follow", args: []string{feedURL}, wantFollows: 1},
+		{name: "already following", args: []string{feedURL}, alreadyFollow: true, wantErr: "Failed to create the feed_follow", wantFollows: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, "alice")
+			alice := mustCreateUser(t, s, "alice")
+			bob := mustCreateUser(t, s, "bob")
+			feed := mustCreateFeed(t, s, bob, "blog", feedURL)
+			if tt.alreadyFollow {
+				mustFollow(t, s, alice, feed)
+			}
+
+			var err error
+			out := captureStdout(t, func() {
+				err = handlerFollow(s, command{name: "follow", args: tt.args}, alice)
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && !strings.Contains(out, "* Feed:          blog") {
+				t.Errorf("output %q doesn't show the followed feed", out)
+			}
+
+			follows, err := s.db.GetFeedFollowsForUser(context.Background(), alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(follows) != tt.wantFollows {
+				t.Errorf("alice follows %d feeds, want %d", len(follows), tt.wantFollows)
+			}
+		})
+	}
+}
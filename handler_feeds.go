@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"flag"
 	"fmt"
+	"math"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,7 +16,7 @@ import (
 func handlerAddFeed(s *state, cmd command, user database.User) error {
 	// Make sure there is enough args
 	if len(cmd.args) < 2 {
-		return fmt.Errorf("usage: %v <name> <url>", cmd.name)
+		return cmd.usageError()
 	}
 
 	// Get the args
@@ -76,12 +80,163 @@ func handlerFeeds(s *state, cmd command) error {
 			return fmt.Errorf("couldn't get user: %w", err)
 		}
 		printFeed(feed, user)
+		printFeedSchedule(feed)
 		fmt.Println("=========================================")
 	}
 
 	return nil
 }
 
+func handlerSchedule(s *state, cmd command) error {
+	feeds, err := s.db.GetFeeds(context.Background())
+	if err != nil {
+		return fmt.Errorf("Failed to get all the feeds from the feeds table: %w\n", err)
+	}
+
+	if len(feeds) == 0 {
+		fmt.Println("No feeds found.")
+		return nil
+	}
+
+	// In the order agg fetches them, feeds never fetched first
+	slices.SortStableFunc(feeds, func(a, b database.Feed) int {
+		if a.NextFetchAt.Valid != b.NextFetchAt.Valid {
+			if !a.NextFetchAt.Valid {
+				return -1
+			}
+			return 1
+		}
+		return a.NextFetchAt.Time.Compare(b.NextFetchAt.Time)
+	})
+
+	fmt.Println("The feeds in the order they are fetched:")
+	fmt.Println("=========================================")
+	for _, feed := range feeds {
+		fmt.Printf("* Name:          %s\n", feed.Name)
+		fmt.Printf("* URL:           %s\n", feed.Url)
+		printFeedSchedule(feed)
+		fmt.Println("=========================================")
+	}
+
+	return nil
+}
+
+// minFetchInterval keeps setinterval from polling a feed too often
+const minFetchInterval = time.Minute
+
+func handlerSetInterval(s *state, cmd command) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 2 {
+		return cmd.usageError()
+	}
+
+	// Get the args
+	url := cmd.args[0]
+	value := cmd.args[1]
+
+	// Get the feed from the DB using the url
+	feed, err := s.db.GetFeedByUrl(context.Background(), url)
+	if err != nil {
+		return fmt.Errorf("Feed with url %s not found\n", url)
+	}
+
+	// "default" clears the interval so the feed's ttl is used again
+	params := database.SetFeedFetchIntervalParams{
+		ID:          feed.ID,
+		UpdatedAt:   time.Now().UTC(),
+		NextFetchAt: feed.NextFetchAt,
+	}
+	if value != "default" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < minFetchInterval || interval/time.Second > math.MaxInt32 {
+			return fmt.Errorf("Invalid interval %s, use a duration of at least %v like 30m or 6h, or default\n", value, minFetchInterval)
+		}
+		params.FetchInterval = sql.NullInt32{Int32: int32(interval / time.Second), Valid: true}
+	}
+
+	// Reschedule from the last fetch so the new interval counts right away,
+	// a feed that was never fetched is due already
+	params.ScheduleReason = feed.ScheduleReason
+	feed.FetchInterval = params.FetchInterval
+	if feed.LastFetchedAt.Valid {
+		next, reason, err := scheduleNextFetch(context.Background(), s.db, s.cfg, feed, feed.LastFetchedAt.Time)
+		if err != nil {
+			return fmt.Errorf("Failed to schedule the next fetch: %w\n", err)
+		}
+		params.NextFetchAt = sql.NullTime{Time: next, Valid: true}
+		params.ScheduleReason = sql.NullString{String: reason, Valid: true}
+	}
+
+	feed, err = s.db.SetFeedFetchInterval(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("Failed to set the fetch interval: %w\n", err)
+	}
+
+	fmt.Println("Fetch interval has been set:")
+	fmt.Printf("* Name:          %s\n", feed.Name)
+	fmt.Printf("* URL:           %s\n", feed.Url)
+	printFeedSchedule(feed)
+	fmt.Println("=========================================")
+
+	return nil
+}
+
+func handlerSetRetention(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	days := fs.Int("days", 0, "how many days of posts to keep")
+	posts := fs.Int("posts", 0, "how many of the newest posts to keep")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	// Make sure there is enough args
+	if len(args) != 1 {
+		return cmd.usageError()
+	}
+
+	// Get the feed from the DB using the url
+	url := args[0]
+	feed, err := s.db.GetFeedByUrl(context.Background(), url)
+	if err != nil {
+		return fmt.Errorf("Feed with url %s not found\n", url)
+	}
+
+	// A flag that isn't given goes back to the global setting
+	params := database.SetFeedRetentionParams{
+		ID:        feed.ID,
+		UpdatedAt: time.Now().UTC(),
+	}
+	var badFlag error
+	fs.Visit(func(f *flag.Flag) {
+		value := *days
+		field := &params.RetentionDays
+		if f.Name == "posts" {
+			value, field = *posts, &params.RetentionPosts
+		}
+		if value < 0 || value > math.MaxInt32 {
+			badFlag = fmt.Errorf("Invalid --%s %d, use a whole number or 0 to keep posts forever\n", f.Name, value)
+		}
+		*field = sql.NullInt32{Int32: int32(value), Valid: true}
+	})
+	if badFlag != nil {
+		return badFlag
+	}
+
+	feed, err = s.db.SetFeedRetention(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("Failed to set the retention: %w\n", err)
+	}
+
+	fmt.Println("Retention has been set:")
+	fmt.Printf("* Name:          %s\n", feed.Name)
+	fmt.Printf("* URL:           %s\n", feed.Url)
+	fmt.Printf("* Keeps Posts:   %v\n", feedRetention(s.cfg, feed))
+	fmt.Println("=========================================")
+
+	return nil
+}
+
 func printFeed(feed database.Feed, user database.User) {
 	fmt.Printf("* ID:            %s\n", feed.ID)
 	fmt.Printf("* Created:       %v\n", feed.CreatedAt)
@@ -90,4 +245,18 @@ func printFeed(feed database.Feed, user database.User) {
 	fmt.Printf("* URL:           %s\n", feed.Url)
 	fmt.Printf("* User:          %s\n", user.Name)
 	fmt.Printf("* LastFetchedAt: %v\n", feed.LastFetchedAt.Time)
+	if feed.LastFetchError.Valid {
+		fmt.Printf("* Last Error:    %s\n", feed.LastFetchError.String)
+	}
+}
+
+// printFeedSchedule shows when the feed is fetched next and why that time
+// was picked
+func printFeedSchedule(feed database.Feed) {
+	if !feed.NextFetchAt.Valid {
+		fmt.Printf("* Next Fetch:    now, it has never been fetched\n")
+		return
+	}
+	fmt.Printf("* Next Fetch:    %v\n", feed.NextFetchAt.Time)
+	fmt.Printf("* Because:       %s\n", feed.ScheduleReason.String)
 }
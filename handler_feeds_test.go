@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHandlerAddFeed(t *testing.T) {
+	const existingURL = "https://example.com/existing.xml"
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     string
+		wantFeeds   int
+		wantFollows int
+	}{
+		{name: "no args", args: nil, wantErr: "usage", wantFeeds: 1},
+		{name: "missing url", args: []string{"blog"}, wantErr: "usage", wantFeeds: 1},
+		{name: "new feed", args: []string{"blog", "https://example.com/rss"}, wantFeeds: 2, wantFollows: 1},
+		{name: "duplicate url", args: []string{"copy", existingURL}, wantErr: "Failed to create the feed", wantFeeds: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, "alice")
+			alice := mustCreateUser(t, s, "alice")
+			bob := mustCreateUser(t, s, "bob")
+			mustCreateFeed(t, s, bob, "existing", existingURL)
+
+			var err error
+			captureStdout(t, func() {
+				err = handlerAddFeed(s, command{name: "addfeed", args: tt.args}, alice)
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+
+			feeds, err := s.db.GetFeeds(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(feeds) != tt.wantFeeds {
+				t.Errorf("%d feeds in the db, want %d", len(feeds), tt.wantFeeds)
+			}
+
+			// The user adding a feed follows it
+			follows, err := s.db.GetFeedFollowsForUser(context.Background(), alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(follows) != tt.wantFollows {
+				t.Fatalf("alice follows %d feeds, want %d", len(follows), tt.wantFollows)
+			}
+			if tt.wantFollows > 0 && follows[0].FeedName != tt.args[0] {
+				t.Errorf("alice follows %s, want %s", follows[0].FeedName, tt.args[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+)
+
+// fetchFormats are the ways the fetch command can print a feed
+var fetchFormats = map[string]func(*RSSFeed) error{
+	"titles": print_rss_feed_titles,
+	"json":   print_rss_feed_json_formatted,
+	"raw":    print_rss_feed,
+}
+
+func handlerFetch(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	format := fs.String("format", "titles", "how to print the feed")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	// Make sure there is enough args
+	if len(args) != 1 {
+		return cmd.usageError()
+	}
+
+	// Check the format before fetching anything
+	printFeed, ok := fetchFormats[*format]
+	if !ok {
+		return fmt.Errorf("Unknown format %q, use titles, json or raw\n", *format)
+	}
+
+	// Nothing is saved, the feed doesn't even need to be added
+	rssFeed, err := fetchFeed(context.Background(), s, args[0])
+	if err != nil {
+		return fmt.Errorf("Failed to fetch feed %s: %w\n", args[0], err)
+	}
+
+	return printFeed(rssFeed)
+}
+
+func print_rss_feed(rssFeed *RSSFeed) error {
+	fmt.Printf("%+v\n", rssFeed)
+	return nil
+}
+
+func print_rss_feed_json_formatted(rssFeed *RSSFeed) error {
+	// print formatted JSON
+	formattedJSON, err := json.MarshalIndent(rssFeed, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(formattedJSON))
+	return nil
+}
+
+func print_rss_feed_titles(rssFeed *RSSFeed) error {
+	for _, item := range rssFeed.Channel.Item {
+		fmt.Printf("* Title: %s\n", item.Title)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// handlerHelp returns the help command, it needs the commands to describe them
+func handlerHelp(cmds *commands) func(*state, command) error {
+	return func(s *state, cmd command) error {
+		if len(cmd.args) > 1 {
+			return cmd.usageError()
+		}
+
+		if len(cmd.args) == 0 {
+			printHelp(cmds)
+			return nil
+		}
+
+		info, ok := cmds.handlers[cmd.args[0]]
+		if !ok {
+			return cmds.unknownCommandError(cmd.args[0])
+		}
+		printCommandHelp(info)
+		return nil
+	}
+}
+
+func printHelp(cmds *commands) {
+	fmt.Printf("Usage: %s [global flags] <command> [args]\n", programName())
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, info := range cmds.list() {
+		fmt.Printf("  %-12s %s\n", info.name, info.description)
+	}
+	fmt.Println()
+	fmt.Println("Global flags:")
+	newGlobalFlags().fs.VisitAll(func(f *flag.Flag) {
+		fmt.Printf("  --%-10s %s\n", f.Name, f.Usage)
+	})
+	fmt.Println()
+	fmt.Printf("Run \"%s help <command>\" for the details of a command\n", programName())
+}
+
+func printCommandHelp(info commandInfo) {
+	fmt.Printf("Usage: %s\n", info.usage())
+	fmt.Println()
+	fmt.Println(info.description)
+
+	if len(info.flags) > 0 {
+		fmt.Println()
+		fmt.Println("Flags:")
+		for _, f := range info.flags {
+			name := "--" + f.name
+			if f.value != "" {
+				name += " <" + f.value + ">"
+			}
+			fmt.Printf("  %-22s %s\n", name, f.description)
+		}
+	}
+
+	if len(info.subcommands) > 0 {
+		fmt.Println()
+		fmt.Println("Subcommands:")
+		for _, sub := range info.subcommands {
+			fmt.Printf("  %-12s %s\n", sub.name, sub.description)
+		}
+	}
+
+	if len(info.examples) > 0 {
+		fmt.Println()
+		fmt.Println("Examples:")
+		for _, example := range info.examples {
+			fmt.Printf("  %s %s\n", programName(), example)
+		}
+	}
+}
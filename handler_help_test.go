@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+)
+
+func TestHelp(t *testing.T) {
+	e := newE2E(t, memory.New())
+	out := e.run("help")
+
+	// Every registered command is listed in the order it was registered
+	last := -1
+	for _, info := range e.cmds.list() {
+		line := fmt.Sprintf("  %-12s %s\n", info.name, info.description)
+		i := strings.Index(out, line)
+		if i < 0 {
+			t.Errorf("help doesn't list %s, want %q in:\n%s", info.name, line, out)
+			continue
+		}
+		if i < last {
+			t.Errorf("help lists %s out of the order it was registered in", info.name)
+		}
+		last = i
+	}
+	newGlobalFlags().fs.VisitAll(func(f *flag.Flag) {
+		if !strings.Contains(out, "--"+f.Name) {
+			t.Errorf("help doesn't list the global flag --%s", f.Name)
+		}
+	})
+}
+
+func TestCommandHelp(t *testing.T) {
+	e := newE2E(t, memory.New())
+
+	for _, info := range e.cmds.list() {
+		t.Run(info.name, func(t *testing.T) {
+			out := e.run("help", info.name)
+
+			want := []string{"Usage: " + info.usage() + "\n", info.description}
+			for _, f := range info.flags {
+				want = append(want, "--"+f.name, f.description)
+			}
+			for _, sub := range info.subcommands {
+				want = append(want, fmt.Sprintf("  %-12s %s\n", sub.name, sub.description))
+			}
+			for _, example := range info.examples {
+				want = append(want, programName()+" "+example+"\n")
+			}
+			for _, w := range want {
+				if !strings.Contains(out, w) {
+					t.Errorf("help %s doesn't print %q:\n%s", info.name, w, out)
+				}
+			}
+		})
+	}
+
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"help", "brwse"}, wantErr: "unknown command: brwse, did you mean: browse?"},
+		{args: []string{"help", "xyzzy"}, wantErr: "unknown command: xyzzy"},
+		{args: []string{"help", "login", "browse"}, wantErr: "usage: help"},
+	}
+	for _, tt := range tests {
+		if _, err := e.runErr(tt.args...); !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s error = %q, want %q", strings.Join(tt.args, " "), err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func handlerHistory(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "how many fetches to show")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	// Make sure there is enough args
+	if len(args) != 1 {
+		return cmd.usageError()
+	}
+	if *limit < 1 {
+		return fmt.Errorf("Invalid limit %d, it has to be at least 1\n", *limit)
+	}
+
+	// Get the feed from the DB using the url
+	url := args[0]
+	feed, err := s.db.GetFeedByUrl(context.Background(), url)
+	if err != nil {
+		return fmt.Errorf("Feed with url %s not found\n", url)
+	}
+
+	fetches, err := s.db.GetFeedFetches(context.Background(), database.GetFeedFetchesParams{
+		FeedID: feed.ID,
+		Limit:  int32(*limit),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to get the fetch history: %w\n", err)
+	}
+
+	if len(fetches) == 0 {
+		fmt.Printf("No fetches of %s recorded yet.\n", url)
+		return nil
+	}
+
+	fmt.Printf("The last %d fetches of %s, newest first:\n", len(fetches), feed.Name)
+	fmt.Println("=========================================")
+	for _, fetch := range fetches {
+		printFeedFetch(fetch)
+		fmt.Println("=========================================")
+	}
+
+	return nil
+}
+
+func printFeedFetch(fetch database.FeedFetch) {
+	fmt.Printf("* Started:       %v\n", fetch.StartedAt)
+	fmt.Printf("* Took:          %v\n", time.Duration(fetch.DurationMs)*time.Millisecond)
+	if fetch.HttpStatus.Valid {
+		fmt.Printf("* HTTP Status:   %d\n", fetch.HttpStatus.Int32)
+	} else {
+		fmt.Printf("* HTTP Status:   none, there was no response\n")
+	}
+	fmt.Printf("* Bytes:         %d\n", fetch.Bytes)
+	fmt.Printf("* Items Parsed:  %d\n", fetch.ItemsParsed)
+	fmt.Printf("* New Posts:     %d\n", fetch.PostsInserted)
+	if fetch.Error.Valid {
+		fmt.Printf("* Error:         %s\n", fetch.Error.String)
+	}
+}
@@ -2,23 +2,38 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jcourtney5/blog-aggregator/internal/database"
 )
 
 func handlerBrowse(s *state, cmd command, user database.User) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	history := fs.String("history", "", "show the edits of a post")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	if *history != "" {
+		return browseHistory(s, user, *history)
+	}
+
 	limit := 2
 
 	// Get the optional limit arg as an int
-	if len(cmd.args) > 0 {
-		if limitInt, err := strconv.Atoi(cmd.args[0]); err == nil {
+	if len(args) > 0 {
+		if limitInt, err := strconv.Atoi(args[0]); err == nil {
 			limit = limitInt
 		} else {
-			log.Printf("Failed to parse limit %s, using default of 2: %v\n", cmd.args[0], err)
+			slog.Warn("failed to parse the limit, using the default of 2", "limit", args[0], "error", err)
 		}
 	}
 
@@ -39,6 +54,199 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 	fmt.Printf("Here are the %d most recent posts for the feeds the user %s follows:\n", len(posts), s.cfg.CurrentUserName)
 	for _, post := range posts {
 		printPost(&post)
+
+		starred, err := s.db.IsPostStarred(context.Background(), database.IsPostStarredParams{UserID: user.ID, PostID: post.ID})
+		if err != nil {
+			return fmt.Errorf("Failed to check if the post is starred: %w\n", err)
+		}
+		if starred {
+			fmt.Println("* Starred:       yes")
+		}
+
+		categories, err := s.db.GetPostCategories(context.Background(), post.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to get the post categories: %w\n", err)
+		}
+		if len(categories) > 0 {
+			fmt.Printf("* Categories:    %s\n", strings.Join(categories, ", "))
+		}
+
+		enclosures, err := s.db.GetPostEnclosures(context.Background(), post.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to get the post enclosures: %w\n", err)
+		}
+		for _, enclosure := range enclosures {
+			printEnclosure(enclosure)
+		}
+		fmt.Println("=========================================")
+
+		// The posts browse shows are read, prune can delete them once
+		// everyone following the feed has read them
+		err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now().UTC(),
+			UserID:    user.ID,
+			PostID:    post.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to mark the post read: %w\n", err)
+		}
+	}
+
+	return nil
+}
+
+func handlerStar(s *state, cmd command, user database.User) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 1 {
+		return cmd.usageError()
+	}
+
+	post, err := findPost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.db.StarPost(context.Background(), database.StarPostParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		PostID:    post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to star the post: %w\n", err)
+	}
+
+	fmt.Printf("Starred %s, prune won't delete it\n", post.Title)
+	return nil
+}
+
+func handlerUnstar(s *state, cmd command, user database.User) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 1 {
+		return cmd.usageError()
+	}
+
+	post, err := findPost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.db.UnstarPost(context.Background(), database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to unstar the post: %w\n", err)
+	}
+
+	if removed == 0 {
+		fmt.Printf("%s is not starred\n", post.Title)
+		return nil
+	}
+	fmt.Printf("Unstarred %s\n", post.Title)
+	return nil
+}
+
+func handlerRead(s *state, cmd command, user database.User) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 1 {
+		return cmd.usageError()
+	}
+
+	post, err := findPost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		PostID:    post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to mark the post read: %w\n", err)
+	}
+
+	fmt.Printf("Marked %s read\n", post.Title)
+	return nil
+}
+
+func handlerUnread(s *state, cmd command, user database.User) error {
+	// Make sure there is enough args
+	if len(cmd.args) != 1 {
+		return cmd.usageError()
+	}
+
+	post, err := findPost(s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to mark the post unread: %w\n", err)
+	}
+
+	if removed == 0 {
+		fmt.Printf("%s is not read\n", post.Title)
+		return nil
+	}
+	fmt.Printf("Marked %s unread, prune won't delete it\n", post.Title)
+	return nil
+}
+
+// findPost gets a post by the ID typed as an arg
+func findPost(s *state, id string) (database.GetPostRow, error) {
+	postID, err := uuid.Parse(id)
+	if err != nil {
+		return database.GetPostRow{}, fmt.Errorf("Invalid post ID %s: %w\n", id, err)
+	}
+
+	post, err := s.db.GetPost(context.Background(), postID)
+	if err != nil {
+		return database.GetPostRow{}, fmt.Errorf("Post with ID %s not found\n", id)
+	}
+	return post, nil
+}
+
+// browseHistory shows a post followed by its older versions
+func browseHistory(s *state, user database.User, id string) error {
+	post, err := findPost(s, id)
+	if err != nil {
+		return err
+	}
+
+	// Like browse, only the posts of the feeds the user follows are shown
+	follows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to get the feeds the user follows: %w\n", err)
+	}
+	if !slices.ContainsFunc(follows, func(follow database.GetFeedFollowsForUserRow) bool { return follow.FeedID == post.FeedID }) {
+		return fmt.Errorf("Post with ID %s not found\n", id)
+	}
+
+	revisions, err := s.db.GetPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		return fmt.Errorf("Failed to get the post revisions: %w\n", err)
+	}
+
+	fmt.Printf("Current version, updated %v:\n", post.UpdatedAt.Format(time.RFC822))
+	printPost((*database.GetPostsForUserRow)(&post))
+	fmt.Println("=========================================")
+
+	if len(revisions) == 0 {
+		fmt.Println("The post has not been edited.")
+		return nil
+	}
+
+	fmt.Printf("The post has been edited %d times, older versions:\n", len(revisions))
+	for _, revision := range revisions {
+		printPostRevision(revision)
 		fmt.Println("=========================================")
 	}
 
@@ -46,9 +254,37 @@ func handlerBrowse(s *state, cmd command, user database.User) error {
 }
 
 func printPost(post *database.GetPostsForUserRow) {
+	fmt.Printf("* ID:            %s\n", post.ID)
 	fmt.Printf("* Feed:          %s\n", post.FeedName)
 	fmt.Printf("* Published At:  %v\n", post.PublishedAt.Time.Format(time.RFC822))
 	fmt.Printf("* Title:         %s\n", post.Title)
 	fmt.Printf("* URL:           %s\n", post.Url)
+	if post.Author.Valid {
+		fmt.Printf("* Author:        %s\n", post.Author.String)
+	}
+	fmt.Printf("* GUID:          %s\n", post.Guid)
 	fmt.Printf("* Description:   %s\n", post.Description.String)
+	if post.Content.Valid {
+		fmt.Printf("* Content:       %s\n", post.Content.String)
+	}
+}
+
+func printEnclosure(enclosure database.PostEnclosure) {
+	fmt.Printf("* Enclosure:     %s\n", enclosure.Url)
+	if enclosure.MimeType.Valid {
+		fmt.Printf("   * Type:       %s\n", enclosure.MimeType.String)
+	}
+	if enclosure.Length.Valid {
+		fmt.Printf("   * Length:     %d bytes\n", enclosure.Length.Int64)
+	}
+}
+
+func printPostRevision(revision database.PostRevision) {
+	fmt.Printf("* Replaced At:   %v\n", revision.CreatedAt.Format(time.RFC822))
+	fmt.Printf("* Published At:  %v\n", revision.PublishedAt.Time.Format(time.RFC822))
+	fmt.Printf("* Title:         %s\n", revision.Title)
+	fmt.Printf("* Description:   %s\n", revision.Description.String)
+	if revision.Content.Valid {
+		fmt.Printf("* Content:       %s\n", revision.Content.String)
+	}
 }
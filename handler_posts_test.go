@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// seedPosts saves posts for the feed, titled in order from oldest to newest
+func seedPosts(t *testing.T, s *state, feed database.Feed, titles ...string) []database.UpsertPostsRow {
+	t.Helper()
+	arg := database.UpsertPostsParams{Now: time.Now().UTC(), FeedID: feed.ID}
+	published := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, title := range titles {
+		arg.Ids = append(arg.Ids, uuid.New())
+		arg.Titles = append(arg.Titles, title)
+		arg.Urls = append(arg.Urls, "https://example.com/"+title)
+		arg.Descriptions = append(arg.Descriptions, "")
+		arg.PublishedAts = append(arg.PublishedAts, published.Add(time.Duration(i)*time.Hour))
+		arg.Contents = append(arg.Contents, "")
+		arg.Guids = append(arg.Guids, title)
+		arg.Authors = append(arg.Authors, "")
+		arg.ContentHashes = append(arg.ContentHashes, title)
+	}
+	rows, err := s.db.UpsertPosts(context.Background(), arg)
+	if err != nil {
+		t.Fatalf("UpsertPosts: %v", err)
+	}
+	return rows
+}
+
+func TestHandlerBrowse(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		follow     bool
+		wantErr    string
+		wantTitles []string
+		wantOut    string
+	}{
+		{name: "default limit", follow: true, wantTitles: []string{"third", "second"}},
+		{name: "limit arg", args: []string{"3"}, follow: true, wantTitles: []string{"third", "second", "first"}},
+		{name: "bad limit uses default", args: []string{"lots"}, follow: true, wantTitles: []string{"third", "second"}},
+		{name: "not following", args: []string{"10"}, wantOut: "No posts found"},
+		{name: "history of a bad id", args: []string{"--history", "nope"}, follow: true, wantErr: "Invalid post ID"},
+		{name: "history of a missing post", args: []string{"--history", uuid.NewString()}, follow: true, wantErr: "not found"},
+		{name: "unknown flag", args: []string{"--bogus"}, follow: true, wantErr: "usage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, "alice")
+			alice := mustCreateUser(t, s, "alice")
+			feed := mustCreateFeed(t, s, alice, "blog", "https://example.com/rss")
+			seedPosts(t, s, feed, "first", "second", "third")
+			if tt.follow {
+				mustFollow(t, s, alice, feed)
+			}
+
+			var err error
+			out := captureStdout(t, func() {
+				err = handlerBrowse(s, command{name: "browse", args: tt.args, usage: "browse [--history <post_id>] [limit]"}, alice)
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+			if !strings.Contains(out, tt.wantOut) {
+				t.Errorf("output %q doesn't contain %q", out, tt.wantOut)
+			}
+
+			// The posts are shown newest first
+			var titles []string
+			for _, line := range strings.Split(out, "\n") {
+				if title, ok := strings.CutPrefix(line, "* Title:         "); ok {
+					titles = append(titles, title)
+				}
+			}
+			if strings.Join(titles, ",") != strings.Join(tt.wantTitles, ",") {
+				t.Errorf("browse showed %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestHandlerBrowseHistory(t *testing.T) {
+	s := newTestState(t, "alice")
+	alice := mustCreateUser(t, s, "alice")
+	bob := mustCreateUser(t, s, "bob")
+	feed := mustCreateFeed(t, s, alice, "blog", "https://example.com/rss")
+	mustFollow(t, s, alice, feed)
+	rows := seedPosts(t, s, feed, "post")
+
+	// Edit the post so it has a revision
+	_, err := s.db.UpsertPosts(context.Background(), database.UpsertPostsParams{
+		Ids:           []uuid.UUID{uuid.New()},
+		Titles:        []string{"post edited"},
+		Urls:          []string{"https://example.com/post"},
+		Descriptions:  []string{""},
+		PublishedAts:  []time.Time{{}},
+		Contents:      []string{""},
+		Guids:         []string{"post"},
+		Authors:       []string{""},
+		ContentHashes: []string{"edited"},
+		Now:           time.Now().UTC(),
+		FeedID:        feed.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() {
+		err = handlerBrowse(s, command{name: "browse", args: []string{"--history", rows[0].ID.String()}}, alice)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"* Title:         post edited", "edited 1 times", "* Title:         post\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q doesn't contain %q", out, want)
+		}
+	}
+
+	// bob doesn't follow the feed, so the post isn't there for bob
+	out = captureStdout(t, func() {
+		err = handlerBrowse(s, command{name: "browse", args: []string{"--history", rows[0].ID.String()}}, bob)
+	})
+	if err == nil || err.Error() != "Post with ID "+rows[0].ID.String()+" not found\n" {
+		t.Errorf("history of a post of a feed bob doesn't follow: err = %v, want not found", err)
+	}
+	if out != "" {
+		t.Errorf("history of a post of a feed bob doesn't follow printed %q", out)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+)
+
+func handlerProfile(s *state, cmd command) error {
+	// Make sure there is enough args
+	if len(cmd.args) < 1 {
+		return cmd.usageError()
+	}
+
+	switch cmd.args[0] {
+	case "list":
+		return profileList(s)
+	case "use":
+		if len(cmd.args) != 2 {
+			return cmd.usageError()
+		}
+		return profileUse(s, cmd.args[1])
+	case "add":
+		if len(cmd.args) != 3 {
+			return cmd.usageError()
+		}
+		return profileAdd(s, cmd.args[1], cmd.args[2])
+	case "remove":
+		if len(cmd.args) != 2 {
+			return cmd.usageError()
+		}
+		return profileRemove(s, cmd.args[1])
+	default:
+		return cmd.usageError()
+	}
+}
+
+func profileList(s *state) error {
+	fmt.Printf("All the profiles:\n")
+	for _, name := range s.cfg.ProfileNames() {
+		profile, _ := s.cfg.LookupProfile(name)
+		current := ""
+		if name == s.cfg.Profile {
+			current = " (current)"
+		}
+		fmt.Printf("* %s%s\n", name, current)
+		fmt.Printf("   * DB URL:  %s\n", config.RedactURL(profile.DbURL))
+		fmt.Printf("   * User:    %s\n", profile.CurrentUserName)
+	}
+	return nil
+}
+
+func profileUse(s *state, name string) error {
+	err := s.cfg.UseProfile(name)
+	if err != nil {
+		return fmt.Errorf("Failed to use profile: %w\n", err)
+	}
+
+	fmt.Printf("Profile '%s' is now active\n", name)
+	return nil
+}
+
+func profileAdd(s *state, name, dbURL string) error {
+	if name == config.DefaultProfile {
+		return fmt.Errorf("Profile name '%s' is reserved\n", name)
+	}
+
+	err := s.cfg.AddProfile(name, dbURL)
+	if err != nil {
+		return fmt.Errorf("Failed to add profile: %w\n", err)
+	}
+
+	fmt.Printf("Profile '%s' has been added\n", name)
+	return nil
+}
+
+func profileRemove(s *state, name string) error {
+	err := s.cfg.RemoveProfile(name)
+	if err != nil {
+		return fmt.Errorf("Failed to remove profile: %w\n", err)
+	}
+
+	fmt.Printf("Profile '%s' has been removed\n", name)
+	return nil
+}
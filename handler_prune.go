@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func handlerPrune(s *state, cmd command) error {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be deleted")
+	args, err := cmd.parseFlags(fs)
+	if err != nil {
+		return err
+	}
+
+	// Make sure there is enough args
+	if len(args) > 1 {
+		return cmd.usageError()
+	}
+
+	// Every feed, or just the one asked for
+	var feeds []database.Feed
+	if len(args) == 1 {
+		feed, err := s.db.GetFeedByUrl(context.Background(), args[0])
+		if err != nil {
+			return fmt.Errorf("Feed with url %s not found\n", args[0])
+		}
+		feeds = append(feeds, feed)
+	} else {
+		feeds, err = s.db.GetFeeds(context.Background())
+		if err != nil {
+			return fmt.Errorf("Failed to get all the feeds from the feeds table: %w\n", err)
+		}
+	}
+
+	verb := "Deleted"
+	if *dryRun {
+		verb = "Would delete"
+	}
+
+	// Posts are stored with the wall clock time, so that is what their age
+	// counts from
+	now := time.Now().UTC()
+	var total int64
+	for _, feed := range feeds {
+		pruned, err := prunePosts(context.Background(), s.db, s.cfg, feed, now, *dryRun)
+		total += pruned
+		if err != nil {
+			return fmt.Errorf("Failed to prune the posts of %s: %w\n", feed.Name, err)
+		}
+		if pruned > 0 {
+			fmt.Printf("%s %d posts of %s, it keeps %v\n", verb, pruned, feed.Name, feedRetention(s.cfg, feed))
+		}
+	}
+
+	if total == 0 {
+		fmt.Println("No posts to prune.")
+		return nil
+	}
+	fmt.Printf("%s %d posts in total.\n", verb, total)
+	return nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+const shellHistoryFileName = ".gator_history"
+
+// maxCompletionPosts is how many of the current user's recent posts are
+// offered as post ID completions
+const maxCompletionPosts = 50
+
+// handlerShell returns the shell command, it needs the commands so each line
+// can be dispatched to the same handlers as the command line
+func handlerShell(cmds *commands) func(*state, command) error {
+	return func(s *state, cmd command) error {
+		// Keep the history next to the config file in the users home directory
+		historyFile := ""
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			historyFile = filepath.Join(homeDir, shellHistoryFileName)
+		}
+
+		rl, err := readline.NewEx(&readline.Config{
+			Prompt:          "gator> ",
+			HistoryFile:     historyFile,
+			AutoComplete:    &shellCompleter{s: s, cmds: cmds},
+			InterruptPrompt: "^C",
+			EOFPrompt:       "exit",
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to start the shell: %w\n", err)
+		}
+		defer rl.Close()
+
+		fmt.Println("Type a command, or \"exit\" to quit")
+		for {
+			line, err := rl.Readline()
+			if errors.Is(err, readline.ErrInterrupt) {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to read the command: %w\n", err)
+			}
+
+			args, err := splitShellArgs(line)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			if len(args) == 0 {
+				continue
+			}
+
+			switch args[0] {
+			case "exit", "quit":
+				return nil
+			case cmd.name:
+				fmt.Println("Already in the shell")
+				continue
+			}
+
+			// Errors are printed and the shell keeps going
+			profile := s.cfg.Profile
+			err = cmds.run(s, command{
+				name: args[0],
+				args: args[1:],
+			})
+			if err != nil {
+				fmt.Printf("Error: %s\n", strings.TrimSpace(err.Error()))
+			}
+
+			// profile use only saves the profile, the next commands have to
+			// run against it
+			if s.cfg.Profile != profile {
+				if err := reloadProfile(s); err != nil {
+					fmt.Printf("Error: %s\n", strings.TrimSpace(err.Error()))
+				}
+			}
+		}
+	}
+}
+
+// reloadProfile loads the config of the active profile and connects to its
+// DB, the old connection is kept if the new one fails
+func reloadProfile(s *state) error {
+	cfg, err := s.cfg.Reload()
+	if err != nil {
+		return fmt.Errorf("Failed to load profile %s: %w\n", s.cfg.Profile, err)
+	}
+
+	if cfg.DbURL != s.cfg.DbURL {
+		db, err := openStore(cfg.DbURL)
+		if err != nil {
+			return fmt.Errorf("Failed to connect to the db of profile %s, restart the shell to use it: %w\n", cfg.Profile, err)
+		}
+		s.db.Close()
+		s.db = db
+	}
+
+	*s.cfg = cfg
+	return nil
+}
+
+// splitShellArgs splits a line into args like a unix shell, single and
+// double quotes group words and a backslash escapes the next char
+func splitShellArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// shellCompleter completes command names for the first word, and the args
+// after it based on the kind of each arg
+type shellCompleter struct {
+	s    *state
+	cmds *commands
+}
+
+func (c *shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	// Only the text before the cursor matters
+	text := string(line[:pos])
+	words := strings.Fields(text)
+
+	// Find the word being completed, empty if the cursor is after a space
+	prefix := ""
+	if len(words) > 0 && !strings.HasSuffix(text, " ") {
+		prefix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	var candidates []string
+	if len(words) == 0 {
+		candidates = append([]string{"exit"}, c.cmds.names...)
+	} else {
+		candidates = c.argCandidates(words[0], words[1:], prefix)
+	}
+
+	var matches [][]rune
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, []rune(candidate[len(prefix):]+" "))
+		}
+	}
+	return matches, len([]rune(prefix))
+}
+
+// argCandidates returns the values for the next arg of a command, given the
+// args already typed and the start of the arg being completed
+func (c *shellCompleter) argCandidates(name string, typed []string, prefix string) []string {
+	info, ok := c.cmds.handlers[name]
+	if !ok {
+		return nil
+	}
+
+	// Complete flag names, and flag values after a flag that takes one
+	if strings.HasPrefix(prefix, "-") {
+		return commandFlagNames(info)
+	}
+	var positional []string
+	for i := 0; i < len(typed); i++ {
+		f, ok := info.flag(typed[i])
+		if !ok {
+			positional = append(positional, typed[i])
+			continue
+		}
+		if f.value == "" {
+			continue
+		}
+		if i == len(typed)-1 {
+			return c.kindCandidates(f.kind)
+		}
+		i++
+	}
+	typed = positional
+
+	args := info.args
+	if len(info.subcommands) > 0 {
+		if len(typed) == 0 {
+			return firstArgChoices(c.cmds, info)
+		}
+		sub, ok := info.subcommand(typed[0])
+		if !ok {
+			return nil
+		}
+		args, typed = sub.args, typed[1:]
+	}
+	if len(typed) >= len(args) {
+		return nil
+	}
+
+	return c.kindCandidates(args[len(typed)].kind)
+}
+
+// kindCandidates returns the values an arg of a kind can take
+func (c *shellCompleter) kindCandidates(kind argKind) []string {
+	switch kind {
+	case argFeedURL:
+		return c.feedURLs()
+	case argPostID:
+		return c.postIDs()
+	case argUsername:
+		return c.usernames()
+	case argProfile:
+		return c.s.cfg.ProfileNames()
+	case argCommand:
+		return c.cmds.names
+	case argShell:
+		return completionShells
+	}
+	return nil
+}
+
+func (c *shellCompleter) usernames() []string {
+	users, err := c.s.db.GetUsers(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(users))
+	for _, user := range users {
+		names = append(names, user.Name)
+	}
+	return names
+}
+
+func (c *shellCompleter) feedURLs() []string {
+	feeds, err := c.s.db.GetFeeds(context.Background())
+	if err != nil {
+		return nil
+	}
+
+	urls := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		urls = append(urls, feed.Url)
+	}
+	return urls
+}
+
+func (c *shellCompleter) postIDs() []string {
+	user, err := c.s.db.GetUser(context.Background(), c.s.cfg.CurrentUserName)
+	if err != nil {
+		return nil
+	}
+
+	posts, err := c.s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  maxCompletionPosts,
+	})
+	if err != nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(posts))
+	for _, post := range posts {
+		ids = append(ids, post.ID.String())
+	}
+	return ids
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestSplitShellArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", line: "", want: nil},
+		{name: "only spaces", line: "  \t ", want: nil},
+		{name: "words", line: "addfeed blog https://example.com/rss", want: []string{"addfeed", "blog", "https://example.com/rss"}},
+		{name: "runs of spaces and tabs", line: "  follow \t\t https://example.com/rss  ", want: []string{"follow", "https://example.com/rss"}},
+		{name: "double quotes", line: `addfeed "Hacker News" https://news.ycombinator.com/rss`, want: []string{"addfeed", "Hacker News", "https://news.ycombinator.com/rss"}},
+		{name: "single quotes", line: `addfeed 'Hacker News' url`, want: []string{"addfeed", "Hacker News", "url"}},
+		{name: "backslash is literal in single quotes", line: `'a\b'`, want: []string{`a\b`}},
+		{name: "escaped quote in double quotes", line: `"say \"hi\""`, want: []string{`say "hi"`}},
+		{name: "escaped space", line: `a\ b c`, want: []string{"a b", "c"}},
+		{name: "escaped backslash", line: `a\\b`, want: []string{`a\b`}},
+		{name: "other quote inside quotes", line: `"it's" '"x"'`, want: []string{"it's", `"x"`}},
+		{name: "quotes join a word", line: `pre"fix"'ed'`, want: []string{"prefixed"}},
+		{name: "empty double quoted arg", line: `register ""`, want: []string{"register", ""}},
+		{name: "empty single quoted arg", line: `'' x`, want: []string{"", "x"}},
+		{name: "unterminated double quote", line: `addfeed "Hacker News`, wantErr: `unterminated " quote`},
+		{name: "unterminated single quote", line: `addfeed 'Hacker`, wantErr: "unterminated ' quote"},
+		{name: "trailing backslash", line: `browse 10\`, wantErr: "trailing backslash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitShellArgs(tt.line)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitShellArgs(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitShellArgs(%q): %v", tt.line, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitShellArgs(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellCompleter(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "one", GUID: "1"}))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "bob")
+	e.run("register", "alice")
+	e.run("addfeed", "blog", srv.FeedURL("/rss"))
+	e.agg(0, 0)
+	user, err := e.s.db.GetUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := e.s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("stored %d posts, want 1: %v", len(stored), err)
+	}
+	posts := []string{stored[0].ID.String()}
+
+	c := &shellCompleter{s: e.s, cmds: e.cmds}
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "bro", want: []string{"browse"}},
+		{line: "ex", want: []string{"exit"}},
+		{line: "log", want: []string{"login"}},
+		{line: "login ", want: []string{"alice", "bob"}},
+		{line: "login a", want: []string{"alice"}},
+		{line: "follow ", want: []string{srv.FeedURL("/rss")}},
+		{line: "follow " + srv.FeedURL("/rss") + " ", want: nil},
+		{line: "profile ", want: []string{"add", "list", "remove", "use"}},
+		{line: "profile u", want: []string{"use"}},
+		{line: "profile use ", want: []string{"default"}},
+		{line: "profile nope ", want: nil},
+		{line: "help addf", want: []string{"addfeed"}},
+		{line: "completion ", want: []string{"bash", "fish", "zsh"}},
+		{line: "browse --", want: []string{"--history"}},
+		{line: "browse --history ", want: posts},
+		{line: "browse --history " + posts[0] + " ", want: nil},
+		{line: "agg --only-user ", want: []string{"alice", "bob"}},
+		{line: "agg --once --only-user a", want: []string{"alice"}},
+		{line: "history --limit 5 ", want: []string{srv.FeedURL("/rss")}},
+		{line: "nope ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			line := []rune(tt.line)
+			matches, n := c.Do(line, len(line))
+
+			// Put the completed words back together to compare them
+			prefix := string(line[len(line)-n:])
+			var got []string
+			for _, match := range matches {
+				got = append(got, prefix+strings.TrimSuffix(string(match), " "))
+			}
+			slices.Sort(got)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("Do(%q) = %q, want %q", tt.line, got, want)
+			}
+		})
+	}
+
+	// Every command and exit are offered on an empty line
+	matches, _ := c.Do(nil, 0)
+	if len(matches) != len(e.cmds.names)+1 {
+		t.Errorf("Do on an empty line offered %d words, want %d", len(matches), len(e.cmds.names)+1)
+	}
+}
+
+func TestReloadProfile(t *testing.T) {
+	dir := t.TempDir()
+	mainURL := "sqlite://" + filepath.Join(dir, "main.db")
+	devURL := "sqlite://" + filepath.Join(dir, "dev.db")
+	path := filepath.Join(dir, ".gatorconfig.json")
+	file := fmt.Sprintf(`{"db_url": %q, "profiles": {"dev": {"db_url": %q, "current_user_name": "bob"}}}`, mainURL, devURL)
+	if err := os.WriteFile(path, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(config.Options{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openStore(cfg.DbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newState(&cfg, db)
+	t.Cleanup(func() { s.db.Close() })
+	mustCreateUser(t, s, "alice")
+
+	if err := profileUse(s, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadProfile(s); err != nil {
+		t.Fatalf("reloadProfile: %v", err)
+	}
+	if s.cfg.DbURL != devURL || s.cfg.CurrentUserName != "bob" {
+		t.Errorf("after profile use dev the config has %s and user %q, want %s and bob", s.cfg.DbURL, s.cfg.CurrentUserName, devURL)
+	}
+	if _, err := s.db.GetUser(context.Background(), "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser of a user of the main DB after profile use dev: %v, want sql.ErrNoRows", err)
+	}
+
+	// Switching back connects to the main DB again
+	if err := profileUse(s, config.DefaultProfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadProfile(s); err != nil {
+		t.Fatalf("reloadProfile: %v", err)
+	}
+	if _, err := s.db.GetUser(context.Background(), "alice"); err != nil {
+		t.Errorf("GetUser after switching back to the main DB: %v", err)
+	}
+}
@@ -7,13 +7,12 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jcourtney5/blog-aggregator/internal/database"
-	"github.com/lib/pq"
 )
 
 func handlerLogin(s *state, cmd command) error {
 	// Make sure there is enough args
 	if len(cmd.args) == 0 {
-		return fmt.Errorf("login missing the <username> arguement")
+		return cmd.usageError()
 	}
 
 	// Get username from first arg
@@ -39,7 +38,7 @@ func handlerLogin(s *state, cmd command) error {
 func handlerRegister(s *state, cmd command) error {
 	// Make sure there is enough args
 	if len(cmd.args) == 0 {
-		return fmt.Errorf("register missing the <username> arguement")
+		return cmd.usageError()
 	}
 
 	// Get username from first arg
@@ -54,20 +53,17 @@ func handlerRegister(s *state, cmd command) error {
 	}
 	user, err := s.db.CreateUser(context.Background(), params)
 	if err != nil {
+		// check for and exit on unique constraint violation
+		if database.IsUniqueViolation(err) {
+			return fmt.Errorf("Username '%s' already exists: %w\n", username, err)
+		}
 		return fmt.Errorf("Failed to create the user in the db: %w\n", err)
 	}
 
 	// Set user which should update and save config file
 	err = s.cfg.SetUser(username)
 	if err != nil {
-		// check for and exit on unique constraint violation
-		if pgerr, ok := err.(*pq.Error); ok {
-			if pgerr.Code == "23505" {
-				return fmt.Errorf("Username '%s' already exists: %w\n", username, err)
-			}
-		} else {
-			return fmt.Errorf("Failed to set user: %w\n", err)
-		}
+		return fmt.Errorf("Failed to set user: %w\n", err)
 	}
 
 	fmt.Println("User has been created:")
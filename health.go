@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxRecentFetches is how many fetch results the status page shows
+const maxRecentFetches = 50
+
+// pingTimeout bounds the DB ping of /healthz
+const pingTimeout = 2 * time.Second
+
+// aggStatus is what agg is doing right now and what it did last, for the
+// health listener
+type aggStatus struct {
+	mu        sync.Mutex
+	started   time.Time
+	lastCycle time.Time
+	inFlight  map[uuid.UUID]fetchEvent
+	// recent is oldest first and holds at most maxRecentFetches fetches
+	recent []fetchEvent
+}
+
+func newAggStatus() *aggStatus {
+	return &aggStatus{
+		started:  time.Now(),
+		inFlight: make(map[uuid.UUID]fetchEvent),
+	}
+}
+
+// startFetch marks a fetch as in flight until finishFetch is called for it
+func (st *aggStatus) startFetch(event fetchEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.inFlight[event.feed.ID] = event
+}
+
+func (st *aggStatus) finishFetch(event fetchEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.inFlight, event.feed.ID)
+	event.end = time.Now()
+	st.recent = append(st.recent, event)
+	if len(st.recent) > maxRecentFetches {
+		st.recent = slices.Delete(st.recent, 0, len(st.recent)-maxRecentFetches)
+	}
+}
+
+func (st *aggStatus) endCycle() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastCycle = time.Now()
+}
+
+// ready says whether a cycle ended within maxAge, with maxAge 0 any cycle
+// that ended will do
+func (st *aggStatus) ready(maxAge time.Duration) (bool, string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.lastCycle.IsZero() {
+		return false, "no cycle has completed yet"
+	}
+	age := time.Since(st.lastCycle)
+	if maxAge > 0 && age > maxAge {
+		return false, fmt.Sprintf("the last cycle completed %v ago, more than %v", age.Round(time.Second), maxAge)
+	}
+	return true, fmt.Sprintf("the last cycle completed %v ago", age.Round(time.Millisecond))
+}
+
+// statusFetch is one fetch as shown on the status page
+type statusFetch struct {
+	Feed     string
+	URL      string
+	Started  string
+	Duration string
+	Status   string
+	NewPosts int
+	Error    string
+}
+
+// statusPage is everything the status page shows
+type statusPage struct {
+	Uptime    string
+	LastCycle string
+	InFlight  []statusFetch
+	Recent    []statusFetch
+}
+
+// page takes a copy of the status for the status page, newest first
+func (st *aggStatus) page() statusPage {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	page := statusPage{Uptime: time.Since(st.started).Round(time.Second).String(), LastCycle: "never"}
+	if !st.lastCycle.IsZero() {
+		page.LastCycle = st.lastCycle.UTC().Format(time.RFC3339)
+	}
+	for _, event := range st.inFlight {
+		page.InFlight = append(page.InFlight, statusFetch{
+			Feed:     event.feed.Name,
+			URL:      event.feed.Url,
+			Started:  event.start.UTC().Format(time.RFC3339),
+			Duration: time.Since(event.start).Round(time.Millisecond).String(),
+		})
+	}
+	slices.SortFunc(page.InFlight, func(a, b statusFetch) int { return strings.Compare(a.Started, b.Started) })
+	for _, event := range slices.Backward(st.recent) {
+		fetch := statusFetch{
+			Feed:     event.feed.Name,
+			URL:      event.feed.Url,
+			Started:  event.start.UTC().Format(time.RFC3339),
+			Duration: event.end.Sub(event.start).Round(time.Millisecond).String(),
+			Status:   event.status,
+			NewPosts: event.result.inserted,
+		}
+		if event.err != nil {
+			fetch.Error = event.err.Error()
+		}
+		page.Recent = append(page.Recent, fetch)
+	}
+	return page
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>gator agg</title></head>
+<body>
+<h1>gator agg</h1>
+<p>Up for {{.Uptime}}, last cycle completed at {{.LastCycle}}</p>
+<h2>In flight</h2>
+{{if .InFlight}}<table>
+<tr><th>Feed</th><th>URL</th><th>Started</th><th>Running for</th></tr>
+{{range .InFlight}}<tr><td>{{.Feed}}</td><td>{{.URL}}</td><td>{{.Started}}</td><td>{{.Duration}}</td></tr>
+{{end}}</table>{{else}}<p>No fetches in flight</p>{{end}}
+<h2>Last {{len .Recent}} fetches</h2>
+{{if .Recent}}<table>
+<tr><th>Feed</th><th>URL</th><th>Started</th><th>Took</th><th>Status</th><th>New posts</th><th>Error</th></tr>
+{{range .Recent}}<tr><td>{{.Feed}}</td><td>{{.URL}}</td><td>{{.Started}}</td><td>{{.Duration}}</td><td>{{.Status}}</td><td>{{.NewPosts}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>{{else}}<p>No fetches yet</p>{{end}}
+</body>
+</html>
+`))
+
+// newHealthMux serves /healthz, /readyz and the status page on /. agg is
+// ready while its last cycle completed within readyAfter
+func newHealthMux(s *state, readyAfter time.Duration) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+		defer cancel()
+		if err := s.db.Ping(ctx); err != nil {
+			http.Error(w, "db ping failed: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, reason := s.status.ready(readyAfter)
+		if !ready {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, reason)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusTemplate.Execute(w, s.status.page())
+	})
+	return mux
+}
+
+// serveHTTP serves handler at addr until the program exits. The address is
+// listened on before returning so a bad one is an error
+func serveHTTP(addr string, handler http.Handler) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	return listener.Addr(), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/database/sqlite"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+// get returns the status code and body of a GET of url
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestHealthz(t *testing.T) {
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "gator.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newE2E(t, store)
+	srv := httptest.NewServer(newHealthMux(e.s, time.Minute))
+	defer srv.Close()
+
+	if code, body := get(t, srv.URL+"/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("/healthz = %d %q, want 200 ok", code, body)
+	}
+
+	// A DB that can't be reached isn't healthy
+	store.Close()
+	if code, body := get(t, srv.URL+"/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "db ping failed") {
+		t.Errorf("/healthz with the DB closed = %d %q, want 503", code, body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	e := newE2E(t, memory.New())
+	srv := httptest.NewServer(newHealthMux(e.s, 50*time.Millisecond))
+	defer srv.Close()
+
+	// Not ready until a cycle completes, and not once it is too long ago
+	if code, body := get(t, srv.URL+"/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "no cycle") {
+		t.Errorf("/readyz before the first cycle = %d %q, want 503", code, body)
+	}
+	e.agg(0, 0)
+	if code, body := get(t, srv.URL+"/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz after a cycle = %d %q, want 200", code, body)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if code, body := get(t, srv.URL+"/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "more than 50ms") {
+		t.Errorf("/readyz after a stuck cycle = %d %q, want 503", code, body)
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	feeds := feedtest.NewServer(t)
+	feeds.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "one", GUID: "1"}))
+	feeds.Set("/broken", feedtest.Status(http.StatusNotFound))
+	feeds.Set("/slow", feedtest.Slow(time.Second, feedtest.RSS("Slow")))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "<b>good</b>", feeds.FeedURL("/good"))
+	e.run("addfeed", "broken", feeds.FeedURL("/broken"))
+	e.agg(0, 0)
+	e.agg(0, 0)
+
+	srv := httptest.NewServer(newHealthMux(e.s, time.Minute))
+	defer srv.Close()
+
+	// The slow feed shows as in flight while it is fetched
+	e.run("addfeed", "slow", feeds.FeedURL("/slow"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.agg(0, 0)
+	}()
+	var page string
+	for range 50 {
+		_, page = get(t, srv.URL+"/")
+		if !strings.Contains(page, "No fetches in flight") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	<-done
+
+	for _, want := range []string{
+		"<td>slow</td><td>" + feeds.FeedURL("/slow") + "</td>",
+		"Last 2 fetches",
+		"<td>&lt;b&gt;good&lt;/b&gt;</td>",
+		"<td>ok</td><td>1</td>",
+		"<td>error</td><td>0</td><td>unexpected status: 404 Not Found</td>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("status page doesn't contain %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestStatusKeepsLastFetches(t *testing.T) {
+	status := newAggStatus()
+	var last string
+	for i := range maxRecentFetches + 10 {
+		feed := database.Feed{ID: uuid.New(), Name: fmt.Sprint("feed ", i)}
+		status.startFetch(fetchEvent{feed: feed})
+		status.finishFetch(fetchEvent{feed: feed, status: outcomeOK})
+		last = feed.Name
+	}
+
+	page := status.page()
+	if len(page.Recent) != maxRecentFetches || len(page.InFlight) != 0 {
+		t.Fatalf("status has %d recent and %d in flight fetches, want %d and 0", len(page.Recent), len(page.InFlight), maxRecentFetches)
+	}
+	if got := page.Recent[0].Feed; got != last {
+		t.Errorf("newest fetch is %s, want %s", got, last)
+	}
+}
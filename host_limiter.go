@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// robotsTTL is how long the Crawl-delay of a host is kept before its
+// robots.txt is fetched again
+const robotsTTL = 24 * time.Hour
+
+// maxCrawlDelay caps the Crawl-delay a robots.txt can ask for, a long wait
+// would hold up every other feed agg is fetching
+const maxCrawlDelay = time.Minute
+
+// maxRobotsBytes is the most of a robots.txt that is read
+const maxRobotsBytes = 512 << 10
+
+// hostLimiter spaces out the requests to each host. Every host gets a token
+// bucket that allows one request per min_host_delay, or per the Crawl-delay
+// of its robots.txt when that is longer. The buckets are kept in memory, so
+// they only space out the requests of one agg process, several agg processes
+// sharing a DB can each send a request to a host at the same time
+type hostLimiter struct {
+	cfg    *config.Config
+	client *http.Client
+
+	mu    sync.Mutex
+	hosts map[string]*hostPolicy
+}
+
+// hostPolicy is how often one host can be sent a request
+type hostPolicy struct {
+	limiter *rate.Limiter
+
+	// mu is held while robots.txt is fetched so it is only fetched once
+	mu         sync.Mutex
+	robotsAt   time.Time
+	crawlDelay time.Duration
+}
+
+func newHostLimiter(cfg *config.Config, client *http.Client) *hostLimiter {
+	return &hostLimiter{
+		cfg:    cfg,
+		client: client,
+		hosts:  make(map[string]*hostPolicy),
+	}
+}
+
+// wait blocks until a request to the host of u is allowed, or ctx is done
+func (h *hostLimiter) wait(ctx context.Context, u *url.URL) error {
+	minDelay := time.Duration(h.cfg.MinHostDelay)
+	host := strings.ToLower(u.Host)
+
+	h.mu.Lock()
+	policy, ok := h.hosts[host]
+	if !ok {
+		policy = &hostPolicy{limiter: rate.NewLimiter(rate.Every(minDelay), 1)}
+		h.hosts[host] = policy
+	}
+	h.mu.Unlock()
+
+	policy.mu.Lock()
+	if time.Since(policy.robotsAt) > robotsTTL {
+		// The robots.txt request counts towards the limit too
+		if err := policy.limiter.Wait(ctx); err != nil {
+			policy.mu.Unlock()
+			return err
+		}
+		crawlDelay, err := h.crawlDelay(ctx, u)
+		if err != nil {
+			policy.mu.Unlock()
+			return err
+		}
+		policy.crawlDelay = crawlDelay
+		policy.robotsAt = time.Now()
+		policy.limiter.SetLimit(rate.Every(max(minDelay, crawlDelay)))
+	}
+	policy.mu.Unlock()
+
+	return policy.limiter.Wait(ctx)
+}
+
+// crawlDelay fetches the robots.txt of the host of u and returns the
+// Crawl-delay it asks of us. A missing or broken robots.txt asks for none,
+// only ctx ending is an error
+func (h *hostLimiter) crawlDelay(ctx context.Context, u *url.URL) (time.Duration, error) {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return 0, nil
+	}
+	req.Header.Set("User-Agent", h.cfg.UserAgent)
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, ctx.Err()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil
+	}
+
+	return parseCrawlDelay(io.LimitReader(resp.Body, maxRobotsBytes), h.cfg.UserAgent), nil
+}
+
+// parseCrawlDelay returns the Crawl-delay of the robots.txt group for
+// userAgent, or of the * group when there is none for it
+func parseCrawlDelay(robots io.Reader, userAgent string) time.Duration {
+	// Groups name the product token, "gator" for "gator/1.0 (+https://...)"
+	var token string
+	if fields := strings.Fields(strings.ToLower(userAgent)); len(fields) > 0 {
+		token, _, _ = strings.Cut(fields[0], "/")
+	}
+
+	var agentDelay, anyDelay time.Duration
+	var agentFound bool
+	var matchesAgent, matchesAny, inUserAgents bool
+
+	scanner := bufio.NewScanner(robots)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key != "user-agent" {
+			inUserAgents = false
+		}
+		switch key {
+		case "user-agent":
+			// User-agent lines in a row share one group
+			if !inUserAgents {
+				matchesAgent, matchesAny = false, false
+			}
+			inUserAgents = true
+			switch agent := strings.ToLower(value); {
+			case agent == "*":
+				matchesAny = true
+			case agent != "" && agent == token:
+				matchesAgent = true
+			}
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			delay := maxCrawlDelay
+			if seconds < maxCrawlDelay.Seconds() {
+				delay = time.Duration(seconds * float64(time.Second))
+			}
+			if matchesAgent {
+				agentDelay, agentFound = delay, true
+			}
+			if matchesAny {
+				anyDelay = delay
+			}
+		}
+	}
+
+	if agentFound {
+		return agentDelay
+	}
+	return anyDelay
+}
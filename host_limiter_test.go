@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestParseCrawlDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		robots    string
+		userAgent string
+		want      time.Duration
+	}{
+		{name: "empty", robots: "", userAgent: "gator", want: 0},
+		{name: "any agent", robots: "User-agent: *\nCrawl-delay: 5\n", userAgent: "gator", want: 5 * time.Second},
+		{name: "fractions of a second", robots: "User-agent: *\nCrawl-delay: 0.5\n", userAgent: "gator", want: 500 * time.Millisecond},
+		{
+			name:      "our group wins over any agent",
+			robots:    "User-agent: *\nCrawl-delay: 10\n\nUser-agent: Gator\nCrawl-delay: 2\n",
+			userAgent: "gator/1.0 (+https://example.com)",
+			want:      2 * time.Second,
+		},
+		{
+			name:      "other agents are ignored",
+			robots:    "User-agent: googlebot\nCrawl-delay: 30\n\nUser-agent: *\nDisallow: /private\n",
+			userAgent: "gator",
+			want:      0,
+		},
+		{
+			name:      "agents in a row share a group",
+			robots:    "User-agent: bingbot\nUser-agent: gator\nCrawl-delay: 3\nUser-agent: *\nCrawl-delay: 1\n",
+			userAgent: "gator",
+			want:      3 * time.Second,
+		},
+		{name: "comments and spacing", robots: "# polite please\n  user-agent : *   # everyone\ncrawl-delay:4 # seconds\n", userAgent: "gator", want: 4 * time.Second},
+		{name: "capped", robots: "User-agent: *\nCrawl-delay: 86400\n", userAgent: "gator", want: maxCrawlDelay},
+		{name: "junk is ignored", robots: "User-agent: *\nCrawl-delay: soon\nCrawl-delay: -1\n", userAgent: "gator", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCrawlDelay(strings.NewReader(tt.robots), tt.userAgent); got != tt.want {
+				t.Errorf("parseCrawlDelay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	const delay = 100 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		robots string
+		// fetches are made at once from separate goroutines
+		fetches int
+		// want is about the least time the fetches can take, the robots.txt
+		// request waits its turn too
+		want time.Duration
+	}{
+		{name: "min_host_delay", fetches: 3, want: 3 * delay},
+		{name: "longer crawl-delay", robots: "User-agent: *\nCrawl-delay: 0.2\n", fetches: 2, want: 2 * 200 * time.Millisecond},
+		{name: "shorter crawl-delay", robots: "User-agent: *\nCrawl-delay: 0.01\n", fetches: 2, want: 2 * delay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := feedtest.NewServer(t)
+			srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "one", GUID: "1"}))
+			if tt.robots != "" {
+				srv.Set("/robots.txt", feedtest.Robots(tt.robots))
+			}
+			other := feedtest.NewServer(t)
+			other.Set("/rss", feedtest.RSS("Other", feedtest.Item{Title: "one", GUID: "1"}))
+
+			s := newTestState(t, "alice")
+			s.cfg.MinHostDelay = config.Duration(delay)
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			errs := make(chan error, tt.fetches)
+			for range tt.fetches {
+				wg.Go(func() {
+					_, err := fetchFeed(context.Background(), s, srv.FeedURL("/rss"))
+					errs <- err
+				})
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatalf("fetchFeed: %v", err)
+				}
+			}
+			// Leave some slack for the tokens that refill while robots.txt
+			// is read
+			if elapsed := time.Since(start); elapsed < tt.want*9/10 {
+				t.Errorf("%d fetches took %v, want at least %v", tt.fetches, elapsed, tt.want)
+			}
+
+			// robots.txt is read once and a different host doesn't wait
+			if got := srv.Requests("/robots.txt"); got != 1 {
+				t.Errorf("robots.txt was fetched %d times, want 1", got)
+			}
+			start = time.Now()
+			if _, err := fetchFeed(context.Background(), s, other.FeedURL("/rss")); err != nil {
+				t.Fatalf("fetchFeed: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed >= 2*delay {
+				t.Errorf("a fetch from another host took %v, want less than %v", elapsed, 2*delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+)
+
+// acceptEncoding lists the compressions decodeBody can undo
+const acceptEncoding = "br, gzip, deflate"
+
+// newHTTPClient returns the client shared by every feed fetch, so
+// connections to a host are kept alive and reused between fetches
+func newHTTPClient(cfg *config.Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.HTTPConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: time.Duration(cfg.HTTPConnectTimeout),
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: cfg.HTTPMaxConnsPerHost,
+		MaxConnsPerHost:     cfg.HTTPMaxConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		// The Accept-Encoding header is set by fetchFeed and the body
+		// decoded by decodeBody, the transport only does gzip on its own
+		DisableCompression: true,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.HTTPTimeout),
+	}
+}
+
+// decodeBody undoes the Content-Encoding of a response, encodings are
+// listed in the order they were applied so they are undone last to first
+func decodeBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			r, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read gzip body: %w", err)
+			}
+			body = r
+		case "deflate":
+			body = newDeflateReader(body)
+		case "br":
+			body = brotli.NewReader(body)
+		default:
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+		}
+	}
+	return body, nil
+}
+
+// newDeflateReader reads a deflate body, which should be zlib wrapped but
+// some servers send raw deflate data instead
+func newDeflateReader(body io.Reader) io.Reader {
+	buffered := bufio.NewReader(body)
+	header, err := buffered.Peek(2)
+	if err == nil && isZlibHeader(header) {
+		if r, err := zlib.NewReader(buffered); err == nil {
+			return r
+		}
+	}
+	return flate.NewReader(buffered)
+}
+
+// isZlibHeader checks the compression method and checksum of a zlib header
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
@@ -2,56 +2,560 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const configFileName = ".gatorconfig.json"
 
+// configFileMode keeps the config file, which holds the DB credentials,
+// readable by the owner only
+const configFileMode os.FileMode = 0600
+
+// envPrefix is prepended to the upper cased setting key to get the name of
+// the environment variable that overrides it (ex: db_url -> GATOR_DB_URL)
+const envPrefix = "GATOR_"
+
+// configPathEnv can point at a different config file, like the --config flag
+const configPathEnv = envPrefix + "CONFIG"
+
+// DefaultProfile is the name of the profile stored in the top level
+// db_url and current_user_name keys of the config file
+const DefaultProfile = "default"
+
+// Source is the layer a config value was taken from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceProfile Source = "profile"
+)
+
 type Config struct {
+	DbURL           string             `json:"db_url"`
+	CurrentUserName string             `json:"current_user_name"`
+	Profile         string             `json:"profile"`
+	Profiles        map[string]Profile `json:"profiles"`
+	// MaxBodyBytes is the largest feed response agg will read
+	MaxBodyBytes ByteSize `json:"max_body_bytes"`
+	// UserAgent is sent with every feed request
+	UserAgent string `json:"user_agent"`
+	// HTTPTimeout bounds a whole feed request, HTTPConnectTimeout only the
+	// connection and TLS handshake
+	HTTPTimeout        Duration `json:"http_timeout"`
+	HTTPConnectTimeout Duration `json:"http_connect_timeout"`
+	// HTTPMaxConnsPerHost limits the connections open to one feed host
+	HTTPMaxConnsPerHost int `json:"http_max_conns_per_host"`
+	// MinHostDelay is the shortest time between two requests to one host
+	MinHostDelay Duration `json:"min_host_delay"`
+	// DefaultFetchInterval is how often a feed is fetched when neither the
+	// user nor the feed's ttl says otherwise
+	DefaultFetchInterval Duration `json:"default_fetch_interval"`
+	// MinFetchInterval and MaxFetchInterval bound the interval picked from
+	// how often a feed publishes
+	MinFetchInterval Duration `json:"min_fetch_interval"`
+	MaxFetchInterval Duration `json:"max_fetch_interval"`
+	// FetchHistoryRetention is how long the history of each fetch is kept
+	FetchHistoryRetention Duration `json:"fetch_history_retention"`
+	// PostRetentionDays and PostRetentionPosts are how long and how many
+	// posts of each feed are kept, 0 keeps them forever. setretention
+	// overrides them for one feed
+	PostRetentionDays  int `json:"post_retention_days"`
+	PostRetentionPosts int `json:"post_retention_posts"`
+	// LogLevel is the least severe level logged, LogFormat is text or json
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+
+	path           string
+	opts           Options
+	sources        map[string]Source
+	defaultProfile Profile
+}
+
+// Profile is a named database and the user logged in to it
+type Profile struct {
 	DbURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
 }
 
+// Options are the overrides passed on the command line
+type Options struct {
+	// Path to the config file, empty means use the env var or the default
+	Path string
+	// Overrides holds setting key -> value pairs from global flags
+	Overrides map[string]string
+}
+
+// Setting is one effective config value and where it came from
+type Setting struct {
+	Key    string
+	Value  string
+	Source Source
+}
+
+type setting struct {
+	key    string
+	get    func(*Config) string
+	set    func(*Config, string) error
+	secret bool
+}
+
+var settings = []setting{
+	{
+		key:    "db_url",
+		get:    func(c *Config) string { return c.DbURL },
+		set:    func(c *Config, v string) error { c.DbURL = v; return nil },
+		secret: true,
+	},
+	{
+		key: "current_user_name",
+		get: func(c *Config) string { return c.CurrentUserName },
+		set: func(c *Config, v string) error { c.CurrentUserName = v; return nil },
+	},
+	{
+		key: "profile",
+		get: func(c *Config) string { return c.Profile },
+		set: func(c *Config, v string) error { c.Profile = v; return nil },
+	},
+	{
+		key: "max_body_bytes",
+		get: func(c *Config) string { return c.MaxBodyBytes.String() },
+		set: func(c *Config, v string) (err error) { c.MaxBodyBytes, err = ParseByteSize(v); return err },
+	},
+	{
+		key: "user_agent",
+		get: func(c *Config) string { return c.UserAgent },
+		set: func(c *Config, v string) error { c.UserAgent = v; return nil },
+	},
+	{
+		key: "http_timeout",
+		get: func(c *Config) string { return c.HTTPTimeout.String() },
+		set: func(c *Config, v string) (err error) { c.HTTPTimeout, err = ParseDuration(v); return err },
+	},
+	{
+		key: "http_connect_timeout",
+		get: func(c *Config) string { return c.HTTPConnectTimeout.String() },
+		set: func(c *Config, v string) (err error) { c.HTTPConnectTimeout, err = ParseDuration(v); return err },
+	},
+	{
+		key: "http_max_conns_per_host",
+		get: func(c *Config) string { return strconv.Itoa(c.HTTPMaxConnsPerHost) },
+		set: func(c *Config, v string) (err error) { c.HTTPMaxConnsPerHost, err = parsePositiveInt(v); return err },
+	},
+	{
+		key: "min_host_delay",
+		get: func(c *Config) string { return c.MinHostDelay.String() },
+		set: func(c *Config, v string) (err error) { c.MinHostDelay, err = ParseDuration(v); return err },
+	},
+	{
+		key: "default_fetch_interval",
+		get: func(c *Config) string { return c.DefaultFetchInterval.String() },
+		set: func(c *Config, v string) (err error) { c.DefaultFetchInterval, err = ParseDuration(v); return err },
+	},
+	{
+		key: "min_fetch_interval",
+		get: func(c *Config) string { return c.MinFetchInterval.String() },
+		set: func(c *Config, v string) (err error) { c.MinFetchInterval, err = ParseDuration(v); return err },
+	},
+	{
+		key: "max_fetch_interval",
+		get: func(c *Config) string { return c.MaxFetchInterval.String() },
+		set: func(c *Config, v string) (err error) { c.MaxFetchInterval, err = ParseDuration(v); return err },
+	},
+	{
+		key: "fetch_history_retention",
+		get: func(c *Config) string { return c.FetchHistoryRetention.String() },
+		set: func(c *Config, v string) (err error) { c.FetchHistoryRetention, err = ParseDuration(v); return err },
+	},
+	{
+		key: "post_retention_days",
+		get: func(c *Config) string { return strconv.Itoa(c.PostRetentionDays) },
+		set: func(c *Config, v string) (err error) { c.PostRetentionDays, err = parseRetention(v); return err },
+	},
+	{
+		key: "post_retention_posts",
+		get: func(c *Config) string { return strconv.Itoa(c.PostRetentionPosts) },
+		set: func(c *Config, v string) (err error) { c.PostRetentionPosts, err = parseRetention(v); return err },
+	},
+	{
+		key: "log_level",
+		get: func(c *Config) string { return c.LogLevel },
+		set: func(c *Config, v string) (err error) { c.LogLevel, err = parseLogLevel(v); return err },
+	},
+	{
+		key: "log_format",
+		get: func(c *Config) string { return c.LogFormat },
+		set: func(c *Config, v string) (err error) { c.LogFormat, err = parseLogFormat(v); return err },
+	},
+}
+
+// parseLogLevel checks a log level is one slog knows, like "debug" or "warn"
+func parseLogLevel(value string) (string, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return "", fmt.Errorf("invalid log level %q, use debug, info, warn or error", value)
+	}
+	return strings.ToLower(value), nil
+}
+
+// parseLogFormat checks a log format is text or json
+func parseLogFormat(value string) (string, error) {
+	switch format := strings.ToLower(value); format {
+	case "text", "json":
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid log format %q, use text or json", value)
+}
+
+// parsePositiveInt parses a count setting
+func parsePositiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid number %q, it must be a positive whole number", value)
+	}
+	return n, nil
+}
+
+// parseRetention parses a post retention setting, 0 keeps posts forever
+func parseRetention(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid retention %q, use a whole number or 0 to keep posts forever", value)
+	}
+	return n, nil
+}
+
+// Default returns the built-in config values
+func Default() Config {
+	config := Config{
+		DbURL:                 "postgres://localhost:5432/gator?sslmode=disable",
+		Profile:               DefaultProfile,
+		MaxBodyBytes:          10 << 20,
+		UserAgent:             "gator",
+		HTTPTimeout:           Duration(20 * time.Second),
+		HTTPConnectTimeout:    Duration(10 * time.Second),
+		HTTPMaxConnsPerHost:   2,
+		MinHostDelay:          Duration(time.Second),
+		DefaultFetchInterval:  Duration(time.Hour),
+		MinFetchInterval:      Duration(15 * time.Minute),
+		MaxFetchInterval:      Duration(24 * time.Hour),
+		FetchHistoryRetention: Duration(30 * 24 * time.Hour),
+		LogLevel:              "info",
+		LogFormat:             "text",
+		sources:               make(map[string]Source),
+	}
+	for _, s := range settings {
+		config.sources[s.key] = SourceDefault
+	}
+	return config
+}
+
+// Load builds the config from the built-in defaults, then the config file,
+// then GATOR_* env vars and finally the command line overrides
+func Load(opts Options) (Config, error) {
+	config := Default()
+	config.opts = opts
+
+	// Work out which config file to use
+	path, explicit := opts.Path, opts.Path != ""
+	if !explicit {
+		path, explicit = os.LookupEnv(configPathEnv)
+	}
+	if !explicit {
+		defaultPath, err := getConfigFilePath()
+		if err != nil {
+			return config, fmt.Errorf("Failed to get config file path: %w\n", err)
+		}
+		path = defaultPath
+	}
+	config.path = path
+
+	// Config file layer, only an explicitly requested file has to exist
+	err := config.readFile()
+	if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		return config, err
+	}
+	if err == nil {
+		warnLoosePermissions(path)
+	}
+
+	// Collect the env var and command line flag layers
+	envValues := make(map[string]string)
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(envPrefix + strings.ToUpper(s.key)); ok {
+			envValues[s.key] = value
+		}
+	}
+	for key := range opts.Overrides {
+		if _, ok := lookupSetting(key); !ok {
+			return config, fmt.Errorf("Unknown config setting: %s\n", key)
+		}
+	}
+
+	// The profile has to be known before its values are applied, and the
+	// env vars and flags still have to win over the profile values
+	if err := config.apply("profile", envValues, SourceEnv); err != nil {
+		return config, err
+	}
+	if err := config.apply("profile", opts.Overrides, SourceFlag); err != nil {
+		return config, err
+	}
+	if err := config.applyProfile(); err != nil {
+		return config, err
+	}
+
+	// Env var layer
+	for _, s := range settings {
+		if err := config.apply(s.key, envValues, SourceEnv); err != nil {
+			return config, err
+		}
+	}
+
+	// Command line flag layer
+	for _, s := range settings {
+		if err := config.apply(s.key, opts.Overrides, SourceFlag); err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
+
+// Reload loads the config again with the options it was loaded with, to
+// pick up the values of a profile switched to with UseProfile
+func (config *Config) Reload() (Config, error) {
+	return Load(config.opts)
+}
+
+// ReadConfig loads the config with no command line overrides
+func ReadConfig() (Config, error) {
+	return Load(Options{})
+}
+
+// Path returns the config file the config was loaded from
+func (config *Config) Path() string {
+	return config.path
+}
+
+// Settings returns the effective value of every setting, secrets are redacted
+func (config *Config) Settings() []Setting {
+	list := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		value := s.get(config)
+		if s.secret {
+			value = RedactURL(value)
+		}
+		list = append(list, Setting{Key: s.key, Value: value, Source: config.sources[s.key]})
+	}
+	return list
+}
+
 func (config *Config) SetUser(username string) error {
 	// Update the current username
 	config.CurrentUserName = username
 
-	// Write the updated config file data
-	return writeConfigFile(*config)
+	// Only the user of the active profile is changed in the file, values
+	// from env vars or flags must not leak into it
+	profile := config.Profile
+	return updateConfigFile(config.path, func(values map[string]any) error {
+		if profile == DefaultProfile {
+			values["current_user_name"] = username
+			return nil
+		}
+		profileValues, ok := profilesMap(values)[profile].(map[string]any)
+		if !ok {
+			return fmt.Errorf("Profile %s not found in the config file\n", profile)
+		}
+		profileValues["current_user_name"] = username
+		return nil
+	})
 }
 
-func ReadConfig() (Config, error) {
-	var config Config
+// ProfileNames returns the default profile followed by the named profiles
+func (config *Config) ProfileNames() []string {
+	names := []string{DefaultProfile}
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names[1:])
+	return names
+}
 
-	// Get the path to the config file
-	fileName, err := getConfigFilePath()
-	if err != nil {
-		return config, fmt.Errorf("Failed to get config file path: %w\n", err)
+// LookupProfile returns the db_url and user stored for a profile
+func (config *Config) LookupProfile(name string) (Profile, bool) {
+	if name == DefaultProfile {
+		return config.defaultProfile, true
 	}
+	profile, ok := config.Profiles[name]
+	return profile, ok
+}
+
+// UseProfile makes name the active profile in the config file
+func (config *Config) UseProfile(name string) error {
+	if _, ok := config.LookupProfile(name); !ok {
+		return fmt.Errorf("Profile %s not found\n", name)
+	}
+
+	config.Profile = name
+	return updateConfigFile(config.path, func(values map[string]any) error {
+		if name == DefaultProfile {
+			delete(values, "profile")
+		} else {
+			values["profile"] = name
+		}
+		return nil
+	})
+}
+
+// AddProfile saves a new named profile in the config file
+func (config *Config) AddProfile(name, dbURL string) error {
+	if _, ok := config.LookupProfile(name); ok {
+		return fmt.Errorf("Profile %s already exists\n", name)
+	}
+
+	profile := Profile{DbURL: dbURL}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]Profile)
+	}
+	config.Profiles[name] = profile
+	return updateConfigFile(config.path, func(values map[string]any) error {
+		profiles := profilesMap(values)
+		profiles[name] = map[string]any{
+			"db_url":            profile.DbURL,
+			"current_user_name": profile.CurrentUserName,
+		}
+		values["profiles"] = profiles
+		return nil
+	})
+}
+
+// RemoveProfile deletes a named profile from the config file, if it was
+// the active profile the default profile becomes active
+func (config *Config) RemoveProfile(name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("The %s profile can't be removed\n", DefaultProfile)
+	}
+	if _, ok := config.Profiles[name]; !ok {
+		return fmt.Errorf("Profile %s not found\n", name)
+	}
+
+	delete(config.Profiles, name)
+	return updateConfigFile(config.path, func(values map[string]any) error {
+		profiles := profilesMap(values)
+		delete(profiles, name)
+		values["profiles"] = profiles
+		if values["profile"] == name {
+			delete(values, "profile")
+		}
+		return nil
+	})
+}
+
+// apply sets key from a layer of values if the layer has it
+func (config *Config) apply(key string, values map[string]string, source Source) error {
+	value, ok := values[key]
+	if !ok {
+		return nil
+	}
+	s, _ := lookupSetting(key)
+	if err := s.set(config, value); err != nil {
+		if source == SourceEnv {
+			key = envPrefix + strings.ToUpper(key)
+		}
+		return fmt.Errorf("Invalid value for %s: %w\n", key, err)
+	}
+	config.sources[key] = source
+	return nil
+}
 
+// applyProfile overlays the values of the active profile
+func (config *Config) applyProfile() error {
+	config.defaultProfile = Profile{
+		DbURL:           config.DbURL,
+		CurrentUserName: config.CurrentUserName,
+	}
+	if config.Profile == "" {
+		config.Profile = DefaultProfile
+	}
+	if config.Profile == DefaultProfile {
+		return nil
+	}
+
+	profile, ok := config.Profiles[config.Profile]
+	if !ok {
+		return fmt.Errorf("Profile %s not found in the config file\n", config.Profile)
+	}
+	config.DbURL = profile.DbURL
+	config.CurrentUserName = profile.CurrentUserName
+	config.sources["db_url"] = SourceProfile
+	config.sources["current_user_name"] = SourceProfile
+	return nil
+}
+
+func (config *Config) readFile() error {
 	// open the file
-	configFile, err := os.Open(fileName)
+	configFile, err := os.Open(config.path)
 	if err != nil {
-		return config, fmt.Errorf("Failed to open config file: %w\n", err)
+		return fmt.Errorf("Failed to open config file: %w\n", err)
 	}
 	defer configFile.Close()
 
 	// Read all the file’s content
 	bytes, err := io.ReadAll(configFile)
 	if err != nil {
-		return config, fmt.Errorf("Failed to read data from config file: %w\n", err)
+		return fmt.Errorf("Failed to read data from config file: %w\n", err)
 	}
 
 	// Unmarshal JSON into the struct
-	err = json.Unmarshal(bytes, &config)
+	err = json.Unmarshal(bytes, config)
 	if err != nil {
-		return config, fmt.Errorf("Error converting JSON to Config struct: %w\n", err)
+		return fmt.Errorf("Error converting JSON to Config struct: %w\n", err)
 	}
 
-	return config, nil
+	// Mark the settings that were in the file
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(bytes, &keys); err != nil {
+		return fmt.Errorf("Error converting JSON to Config struct: %w\n", err)
+	}
+	for _, s := range settings {
+		if _, ok := keys[s.key]; ok {
+			config.sources[s.key] = SourceFile
+		}
+	}
+
+	return nil
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// RedactURL hides the password in a connection string
+func RedactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
 }
 
 func getConfigFilePath() (string, error) {
@@ -64,24 +568,108 @@ func getConfigFilePath() (string, error) {
 	return configFileFullPath, nil
 }
 
-func writeConfigFile(cfg Config) error {
-	// Serialize struct to JSON with indentation
-	data, err := json.MarshalIndent(cfg, "", "  ")
+// updateConfigFile reads the raw config file, applies update and writes it
+// back so keys we don't know about are kept. The config file lock is held
+// for the whole read-modify-write so concurrent gator processes can't lose
+// each other's changes
+func updateConfigFile(path string, update func(map[string]any) error) error {
+	unlock, err := lockConfigFile(path)
 	if err != nil {
-		return fmt.Errorf("Failed to convert config to JSON: %w\n", err)
+		return fmt.Errorf("Failed to lock config file: %w\n", err)
+	}
+	defer unlock()
+
+	values := make(map[string]any)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("Error converting JSON to Config struct: %w\n", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Failed to read data from config file: %w\n", err)
 	}
 
-	// Get the path to the config file
-	configFile, err := getConfigFilePath()
+	if err := update(values); err != nil {
+		return err
+	}
+
+	return writeConfigFile(path, values)
+}
+
+// profilesMap returns the raw profiles object of the config file
+func profilesMap(values map[string]any) map[string]any {
+	profiles, ok := values["profiles"].(map[string]any)
+	if !ok {
+		profiles = make(map[string]any)
+	}
+	return profiles
+}
+
+// writeConfigFile writes to a temp file next to the config file and renames
+// it into place, so a crash never leaves a truncated config behind
+func writeConfigFile(path string, values map[string]any) error {
+	// Serialize to JSON with indentation
+	data, err := json.MarshalIndent(values, "", "  ")
 	if err != nil {
-		return fmt.Errorf("Failed to get config file path: %w\n", err)
+		return fmt.Errorf("Failed to convert config to JSON: %w\n", err)
 	}
 
-	// Write JSON data to file
-	err = os.WriteFile(configFile, data, 0644)
+	// Create the temp file in the same dir so the rename is atomic
+	dir := filepath.Dir(path)
+	tmpFile, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
 	if err != nil {
+		return fmt.Errorf("Failed to create temp config file: %w\n", err)
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	// The file holds the DB credentials so only the owner can read it
+	if err := tmpFile.Chmod(configFileMode); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("Failed to set config file permissions: %w\n", err)
+	}
+
+	// Write JSON data to the temp file and flush it to disk
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("Failed to write data to config file: %w\n", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
 		return fmt.Errorf("Failed to write data to config file: %w\n", err)
 	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("Failed to write data to config file: %w\n", err)
+	}
+
+	// Swap the new file into place
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("Failed to replace config file: %w\n", err)
+	}
+	syncDir(dir)
 
 	return nil
 }
+
+// syncDir flushes the rename to disk, not every platform supports this so
+// errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
+
+// warnLoosePermissions logs a warning if other users can read the config file
+func warnLoosePermissions(path string) {
+	info, err := os.Stat(path)
+	if err != nil || runtime.GOOS == "windows" {
+		return
+	}
+	// Only group and other bits matter, an owner only 0700 file is fine
+	if info.Mode().Perm()&0o077 != 0 {
+		slog.Warn("config file holds the DB credentials but other users can read it, run chmod 600 on it", "path", path, "permissions", info.Mode().Perm().String())
+	}
+}
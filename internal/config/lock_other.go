@@ -0,0 +1,8 @@
+//go:build !unix
+
+package config
+
+// lockConfigFile is a no-op where flock isn't available
+func lockConfigFile(path string) (func(), error) {
+	return func() {}, nil
+}
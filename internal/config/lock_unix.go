@@ -0,0 +1,29 @@
+//go:build unix
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockConfigFile takes an exclusive lock on a lock file next to the config
+// file and returns the func that releases it. A separate file is locked
+// because the config file itself is replaced on every write
+func lockConfigFile(path string) (func(), error) {
+	lockFile, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, configFileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes, in the config it can be a plain number or
+// a string with a unit like "10MB" (units are powers of 1024)
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size like "512KB", "10MB" or "1048576"
+func ParseByteSize(original string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(original))
+	value = strings.Replace(value, "IB", "B", 1)
+
+	unit := ByteSize(1)
+	for _, u := range byteUnits {
+		if number, ok := strings.CutSuffix(value, u.suffix); ok {
+			value, unit = strings.TrimSpace(number), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, use a positive number of bytes or a size like 10MB", original)
+	}
+	return ByteSize(n) * unit, nil
+}
+
+func (b ByteSize) String() string {
+	for _, u := range byteUnits {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatInt(int64(b/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		if n <= 0 {
+			return fmt.Errorf("invalid size %d, it must be positive", n)
+		}
+		*b = ByteSize(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("size must be a number of bytes or a string like \"10MB\"")
+	}
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
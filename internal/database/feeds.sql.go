@@ -23,7 +23,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
 `
 
 type CreateFeedParams struct {
@@ -53,12 +53,21 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds WHERE url = $1
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts FROM feeds WHERE url = $1
 `
 
 func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
@@ -72,12 +81,21 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts FROM feeds
 `
 
 func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
@@ -97,6 +115,111 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.LastFetchError,
+			&i.FetchInterval,
+			&i.Ttl,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.ScheduleReason,
+			&i.RetentionDays,
+			&i.RetentionPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedsToFetch = `-- name: GetFeedsToFetch :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1::timestamp
+ORDER BY next_fetch_at ASC NULLS FIRST
+`
+
+func (q *Queries) GetFeedsToFetch(ctx context.Context, now time.Time) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsToFetch, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.LastFetchError,
+			&i.FetchInterval,
+			&i.Ttl,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.ScheduleReason,
+			&i.RetentionDays,
+			&i.RetentionPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedFeedsToFetch = `-- name: GetFollowedFeedsToFetch :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= $1::timestamp)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST
+`
+
+// Feeds nobody follows are left out
+func (q *Queries) GetFollowedFeedsToFetch(ctx context.Context, now time.Time) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsToFetch, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.LastFetchError,
+			&i.FetchInterval,
+			&i.Ttl,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.ScheduleReason,
+			&i.RetentionDays,
+			&i.RetentionPosts,
 		); err != nil {
 			return nil, err
 		}
@@ -112,14 +235,15 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
 FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
+WHERE next_fetch_at IS NULL OR next_fetch_at <= $1::timestamp
+ORDER BY next_fetch_at ASC NULLS FIRST
 LIMIT 1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+func (q *Queries) GetNextFeedToFetch(ctx context.Context, now time.Time) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedToFetch, now)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -129,25 +253,312 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+const getNextFollowedFeedToFetch = `-- name: GetNextFollowedFeedToFetch :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= $1::timestamp)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1
+`
+
+// Feeds nobody follows are left out
+func (q *Queries) GetNextFollowedFeedToFetch(ctx context.Context, now time.Time) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFollowedFeedToFetch, now)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+const getNextUserFeedToFetch = `-- name: GetNextUserFeedToFetch :one
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.last_fetch_error, feeds.fetch_interval, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.next_fetch_at, feeds.schedule_reason, feeds.retention_days, feeds.retention_posts
+FROM feeds
+INNER JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+AND (feeds.next_fetch_at IS NULL OR feeds.next_fetch_at <= $2::timestamp)
+ORDER BY feeds.next_fetch_at ASC NULLS FIRST
+LIMIT 1
+`
+
+type GetNextUserFeedToFetchParams struct {
+	UserID uuid.UUID
+	Now    time.Time
+}
+
+func (q *Queries) GetNextUserFeedToFetch(ctx context.Context, arg GetNextUserFeedToFetchParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextUserFeedToFetch, arg.UserID, arg.Now)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+const getUserFeedsToFetch = `-- name: GetUserFeedsToFetch :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.last_fetch_error, feeds.fetch_interval, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.next_fetch_at, feeds.schedule_reason, feeds.retention_days, feeds.retention_posts
+FROM feeds
+INNER JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+AND (feeds.next_fetch_at IS NULL OR feeds.next_fetch_at <= $2::timestamp)
+ORDER BY feeds.next_fetch_at ASC NULLS FIRST
+`
+
+type GetUserFeedsToFetchParams struct {
+	UserID uuid.UUID
+	Now    time.Time
+}
+
+func (q *Queries) GetUserFeedsToFetch(ctx context.Context, arg GetUserFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getUserFeedsToFetch, arg.UserID, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.LastFetchError,
+			&i.FetchInterval,
+			&i.Ttl,
+			&i.SkipHours,
+			&i.SkipDays,
+			&i.NextFetchAt,
+			&i.ScheduleReason,
+			&i.RetentionDays,
+			&i.RetentionPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markFeedFetchFailed = `-- name: MarkFeedFetchFailed :one
+UPDATE feeds
+SET updated_at = $2, last_fetched_at = $3, last_fetch_error = $4,
+    next_fetch_at = $5, schedule_reason = $6
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+`
+
+type MarkFeedFetchFailedParams struct {
+	ID             uuid.UUID
+	UpdatedAt      time.Time
+	LastFetchedAt  sql.NullTime
+	LastFetchError sql.NullString
+	NextFetchAt    sql.NullTime
+	ScheduleReason sql.NullString
+}
+
+func (q *Queries) MarkFeedFetchFailed(ctx context.Context, arg MarkFeedFetchFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetchFailed,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.LastFetchedAt,
+		arg.LastFetchError,
+		arg.NextFetchAt,
+		arg.ScheduleReason,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
 	)
 	return i, err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
 UPDATE feeds
-SET updated_at = $2, last_fetched_at = $3
+SET updated_at = $2, last_fetched_at = $3, last_fetch_error = NULL,
+    next_fetch_at = $4, ttl = $5, skip_hours = $6, skip_days = $7, schedule_reason = $8
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
 `
 
 type MarkFeedFetchedParams struct {
-	ID            uuid.UUID
-	UpdatedAt     time.Time
-	LastFetchedAt sql.NullTime
+	ID             uuid.UUID
+	UpdatedAt      time.Time
+	LastFetchedAt  sql.NullTime
+	NextFetchAt    sql.NullTime
+	Ttl            sql.NullInt32
+	SkipHours      int32
+	SkipDays       int32
+	ScheduleReason sql.NullString
 }
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, arg.ID, arg.UpdatedAt, arg.LastFetchedAt)
+	row := q.db.QueryRowContext(ctx, markFeedFetched,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.LastFetchedAt,
+		arg.NextFetchAt,
+		arg.Ttl,
+		arg.SkipHours,
+		arg.SkipDays,
+		arg.ScheduleReason,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+const setFeedFetchInterval = `-- name: SetFeedFetchInterval :one
+UPDATE feeds
+SET updated_at = $2, fetch_interval = $3, next_fetch_at = $4, schedule_reason = $5
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+`
+
+type SetFeedFetchIntervalParams struct {
+	ID             uuid.UUID
+	UpdatedAt      time.Time
+	FetchInterval  sql.NullInt32
+	NextFetchAt    sql.NullTime
+	ScheduleReason sql.NullString
+}
+
+func (q *Queries) SetFeedFetchInterval(ctx context.Context, arg SetFeedFetchIntervalParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedFetchInterval,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.FetchInterval,
+		arg.NextFetchAt,
+		arg.ScheduleReason,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+const setFeedRetention = `-- name: SetFeedRetention :one
+UPDATE feeds
+SET updated_at = $2, retention_days = $3, retention_posts = $4
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts
+`
+
+type SetFeedRetentionParams struct {
+	ID             uuid.UUID
+	UpdatedAt      time.Time
+	RetentionDays  sql.NullInt32
+	RetentionPosts sql.NullInt32
+}
+
+func (q *Queries) SetFeedRetention(ctx context.Context, arg SetFeedRetentionParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedRetention,
+		arg.ID,
+		arg.UpdatedAt,
+		arg.RetentionDays,
+		arg.RetentionPosts,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -157,6 +568,15 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
 	)
 	return i, err
 }
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (s *Store) CreateFeedFetch(ctx context.Context, arg database.CreateFeedFetchParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.feedFetches, func(f database.FeedFetch) bool { return f.ID == arg.ID }) >= 0 {
+		return uniqueViolation("feed_fetches_pkey")
+	}
+	if find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.FeedID }) < 0 {
+		return errForeignKey
+	}
+	s.data.feedFetches = append(s.data.feedFetches, database.FeedFetch(arg))
+	return nil
+}
+
+func (s *Store) DeleteFeedFetchesBefore(ctx context.Context, startedAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.data.feedFetches)
+	s.data.feedFetches = slices.DeleteFunc(s.data.feedFetches, func(f database.FeedFetch) bool {
+		return f.StartedAt.Before(startedAt)
+	})
+	return int64(before - len(s.data.feedFetches)), nil
+}
+
+// GetFeedFetches returns the newest fetches of a feed first
+func (s *Store) GetFeedFetches(ctx context.Context, arg database.GetFeedFetchesParams) ([]database.FeedFetch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var fetches []database.FeedFetch
+	for _, f := range s.data.feedFetches {
+		if f.FeedID == arg.FeedID {
+			fetches = append(fetches, f)
+		}
+	}
+	slices.SortStableFunc(fetches, func(a, b database.FeedFetch) int {
+		return cmp.Compare(b.StartedAt.UnixNano(), a.StartedAt.UnixNano())
+	})
+	return fetches[:max(0, min(len(fetches), int(arg.Limit)))], nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.feedFollows, func(ff database.FeedFollow) bool {
+		return ff.ID == arg.ID || (ff.UserID == arg.UserID && ff.FeedID == arg.FeedID)
+	}) >= 0 {
+		return database.CreateFeedFollowRow{}, uniqueViolation("feed_follows_user_id_feed_id_key")
+	}
+	user, err := one(s.data.users, func(u database.User) bool { return u.ID == arg.UserID })
+	if err != nil {
+		return database.CreateFeedFollowRow{}, errForeignKey
+	}
+	feed, err := one(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.FeedID })
+	if err != nil {
+		return database.CreateFeedFollowRow{}, errForeignKey
+	}
+
+	s.data.feedFollows = append(s.data.feedFollows, database.FeedFollow{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+	})
+	return database.CreateFeedFollowRow{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		FeedName:  feed.Name,
+		UserName:  user.Name,
+	}, nil
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []database.GetFeedFollowsForUserRow
+	for _, ff := range s.data.feedFollows {
+		if ff.UserID != userID {
+			continue
+		}
+		user, _ := one(s.data.users, func(u database.User) bool { return u.ID == ff.UserID })
+		feed, _ := one(s.data.feeds, func(f database.Feed) bool { return f.ID == ff.FeedID })
+		items = append(items, database.GetFeedFollowsForUserRow{
+			ID:        ff.ID,
+			CreatedAt: ff.CreatedAt,
+			UpdatedAt: ff.UpdatedAt,
+			UserID:    ff.UserID,
+			FeedID:    ff.FeedID,
+			FeedName:  feed.Name,
+			UserName:  user.Name,
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) RemoveFeedFollow(ctx context.Context, arg database.RemoveFeedFollowParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.feedFollows = slices.DeleteFunc(s.data.feedFollows, func(ff database.FeedFollow) bool {
+		return ff.UserID == arg.UserID && ff.FeedID == arg.FeedID
+	})
+	return nil
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.ID }) >= 0 {
+		return database.Feed{}, uniqueViolation("feeds_pkey")
+	}
+	if find(s.data.feeds, func(f database.Feed) bool { return f.Url == arg.Url }) >= 0 {
+		return database.Feed{}, uniqueViolation("feeds_url_key")
+	}
+	if find(s.data.users, func(u database.User) bool { return u.ID == arg.UserID }) < 0 {
+		return database.Feed{}, errForeignKey
+	}
+
+	feed := database.Feed{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Name:      arg.Name,
+		Url:       arg.Url,
+		UserID:    arg.UserID,
+	}
+	s.data.feeds = append(s.data.feeds, feed)
+	return feed, nil
+}
+
+func (s *Store) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return one(s.data.feeds, func(f database.Feed) bool { return f.Url == url })
+}
+
+func (s *Store) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.data.feeds), nil
+}
+
+// GetFeedsToFetch returns the feeds due at now by next_fetch_at, feeds that
+// were never fetched come first
+func (s *Store) GetFeedsToFetch(ctx context.Context, now time.Time) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dueFeeds(now, anyFeed), nil
+}
+
+// GetFollowedFeedsToFetch is GetFeedsToFetch without the feeds nobody
+// follows
+func (s *Store) GetFollowedFeedsToFetch(ctx context.Context, now time.Time) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dueFeeds(now, s.followedBy(uuid.NullUUID{})), nil
+}
+
+// GetUserFeedsToFetch is GetFeedsToFetch for the feeds the user follows
+func (s *Store) GetUserFeedsToFetch(ctx context.Context, arg database.GetUserFeedsToFetchParams) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dueFeeds(arg.Now, s.followedBy(uuid.NullUUID{UUID: arg.UserID, Valid: true})), nil
+}
+
+// GetNextFeedToFetch returns the due feed with the earliest next_fetch_at,
+// feeds that were never fetched come first
+func (s *Store) GetNextFeedToFetch(ctx context.Context, now time.Time) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return first(s.dueFeeds(now, anyFeed))
+}
+
+// GetNextFollowedFeedToFetch is GetNextFeedToFetch without the feeds nobody
+// follows
+func (s *Store) GetNextFollowedFeedToFetch(ctx context.Context, now time.Time) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return first(s.dueFeeds(now, s.followedBy(uuid.NullUUID{})))
+}
+
+// GetNextUserFeedToFetch is GetNextFeedToFetch for the feeds the user follows
+func (s *Store) GetNextUserFeedToFetch(ctx context.Context, arg database.GetNextUserFeedToFetchParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return first(s.dueFeeds(arg.Now, s.followedBy(uuid.NullUUID{UUID: arg.UserID, Valid: true})))
+}
+
+func first(feeds []database.Feed) (database.Feed, error) {
+	if len(feeds) == 0 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	return feeds[0], nil
+}
+
+func (s *Store) dueFeeds(now time.Time, keep func(database.Feed) bool) []database.Feed {
+	var due []database.Feed
+	for _, feed := range s.data.feeds {
+		if (!feed.NextFetchAt.Valid || !feed.NextFetchAt.Time.After(now)) && keep(feed) {
+			due = append(due, feed)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b database.Feed) int {
+		return compareNullTime(a.NextFetchAt, b.NextFetchAt)
+	})
+	return due
+}
+
+func anyFeed(database.Feed) bool { return true }
+
+// followedBy keeps the feeds the user follows, or that anyone follows when
+// userID is NULL
+func (s *Store) followedBy(userID uuid.NullUUID) func(database.Feed) bool {
+	return func(feed database.Feed) bool {
+		return find(s.data.feedFollows, func(ff database.FeedFollow) bool {
+			return ff.FeedID == feed.ID && (!userID.Valid || ff.UserID == userID.UUID)
+		}) >= 0
+	}
+}
+
+func (s *Store) MarkFeedFetchFailed(ctx context.Context, arg database.MarkFeedFetchFailedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.ID })
+	if i < 0 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.data.feeds[i].UpdatedAt = arg.UpdatedAt
+	s.data.feeds[i].LastFetchedAt = arg.LastFetchedAt
+	s.data.feeds[i].LastFetchError = arg.LastFetchError
+	s.data.feeds[i].NextFetchAt = arg.NextFetchAt
+	s.data.feeds[i].ScheduleReason = arg.ScheduleReason
+	return s.data.feeds[i], nil
+}
+
+func (s *Store) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.ID })
+	if i < 0 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.data.feeds[i].UpdatedAt = arg.UpdatedAt
+	s.data.feeds[i].LastFetchedAt = arg.LastFetchedAt
+	s.data.feeds[i].LastFetchError = sql.NullString{}
+	s.data.feeds[i].NextFetchAt = arg.NextFetchAt
+	s.data.feeds[i].Ttl = arg.Ttl
+	s.data.feeds[i].SkipHours = arg.SkipHours
+	s.data.feeds[i].SkipDays = arg.SkipDays
+	s.data.feeds[i].ScheduleReason = arg.ScheduleReason
+	return s.data.feeds[i], nil
+}
+
+func (s *Store) SetFeedFetchInterval(ctx context.Context, arg database.SetFeedFetchIntervalParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.ID })
+	if i < 0 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.data.feeds[i].UpdatedAt = arg.UpdatedAt
+	s.data.feeds[i].FetchInterval = arg.FetchInterval
+	s.data.feeds[i].NextFetchAt = arg.NextFetchAt
+	s.data.feeds[i].ScheduleReason = arg.ScheduleReason
+	return s.data.feeds[i], nil
+}
+
+func (s *Store) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.ID })
+	if i < 0 {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	s.data.feeds[i].UpdatedAt = arg.UpdatedAt
+	s.data.feeds[i].RetentionDays = arg.RetentionDays
+	s.data.feeds[i].RetentionPosts = arg.RetentionPosts
+	return s.data.feeds[i], nil
+}
+
+// compareNullTime orders NULL before every time, like NULLS FIRST
+func compareNullTime(a, b sql.NullTime) int {
+	switch {
+	case !a.Valid && !b.Valid:
+		return 0
+	case !a.Valid:
+		return -1
+	case !b.Valid:
+		return 1
+	}
+	return a.Time.Compare(b.Time)
+}
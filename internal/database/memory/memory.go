@@ -0,0 +1,116 @@
+// Package memory is a database.Store that keeps everything in memory, for
+// testing the commands without a DB. It follows the same contract as the
+// Postgres and SQLite stores, including unique constraints and cascades
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// errForeignKey is returned when a row points at a row that doesn't exist
+var errForeignKey = errors.New("foreign key violation")
+
+// Store is the in memory database.Store, the zero value is not usable, use
+// New
+type Store struct {
+	// mu guards data, every query holds it
+	mu   sync.Mutex
+	data *data
+
+	// txMu runs the transactions one at a time
+	txMu sync.Mutex
+}
+
+var _ database.Store = (*Store)(nil)
+
+// data is every table, rows are kept in insertion order
+type data struct {
+	users       []database.User
+	feeds       []database.Feed
+	feedFollows []database.FeedFollow
+	feedFetches []database.FeedFetch
+	posts       []database.Post
+	categories  []database.PostCategory
+	enclosures  []database.PostEnclosure
+	revisions   []database.PostRevision
+	reads       []database.PostRead
+	stars       []database.PostStar
+	pruned      []database.PrunedPost
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{data: &data{}}
+}
+
+// clone copies the tables so a transaction can be rolled back
+func (d *data) clone() *data {
+	return &data{
+		users:       slices.Clone(d.users),
+		feeds:       slices.Clone(d.feeds),
+		feedFollows: slices.Clone(d.feedFollows),
+		feedFetches: slices.Clone(d.feedFetches),
+		posts:       slices.Clone(d.posts),
+		categories:  slices.Clone(d.categories),
+		enclosures:  slices.Clone(d.enclosures),
+		revisions:   slices.Clone(d.revisions),
+		reads:       slices.Clone(d.reads),
+		stars:       slices.Clone(d.stars),
+		pruned:      slices.Clone(d.pruned),
+	}
+}
+
+// ExecTx runs fn against the store and puts the tables back the way they
+// were if it fails. Queries run outside of ExecTx while it runs are not
+// isolated from it, the tests that use this store don't need that
+func (s *Store) ExecTx(ctx context.Context, fn func(database.Querier) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Ping always works, there is no connection to lose
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+// uniqueViolation is the error for a row that breaks a unique constraint
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("%w: %s", database.ErrUniqueViolation, constraint)
+}
+
+// find returns the index of the first row that matches, or -1
+func find[T any](rows []T, match func(T) bool) int {
+	return slices.IndexFunc(rows, match)
+}
+
+// one returns the first row that matches, or sql.ErrNoRows like QueryRow
+func one[T any](rows []T, match func(T) bool) (T, error) {
+	if i := find(rows, match); i >= 0 {
+		return rows[i], nil
+	}
+	var zero T
+	return zero, sql.ErrNoRows
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return New()
+	})
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// MarkPostRead keeps the first read when a post is read twice
+func (s *Store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.reads, func(r database.PostRead) bool { return r.ID == arg.ID }) >= 0 {
+		return uniqueViolation("post_reads_pkey")
+	}
+	if find(s.data.users, func(u database.User) bool { return u.ID == arg.UserID }) < 0 || !s.hasPost(arg.PostID) {
+		return errForeignKey
+	}
+	if find(s.data.reads, func(r database.PostRead) bool {
+		return r.UserID == arg.UserID && r.PostID == arg.PostID
+	}) >= 0 {
+		return nil
+	}
+	s.data.reads = append(s.data.reads, database.PostRead(arg))
+	return nil
+}
+
+func (s *Store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.data.reads)
+	s.data.reads = slices.DeleteFunc(s.data.reads, func(r database.PostRead) bool {
+		return r.UserID == arg.UserID && r.PostID == arg.PostID
+	})
+	return int64(before - len(s.data.reads)), nil
+}
+
+// isUnread reports whether someone following the post's feed hasn't read it
+func (s *Store) isUnread(post database.Post) bool {
+	for _, follow := range s.data.feedFollows {
+		if follow.FeedID != post.FeedID {
+			continue
+		}
+		if find(s.data.reads, func(r database.PostRead) bool {
+			return r.UserID == follow.UserID && r.PostID == post.ID
+		}) < 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (s *Store) IsPostStarred(ctx context.Context, arg database.IsPostStarredParams) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return find(s.data.stars, func(p database.PostStar) bool {
+		return p.UserID == arg.UserID && p.PostID == arg.PostID
+	}) >= 0, nil
+}
+
+// StarPost keeps the first star when a post is starred twice
+func (s *Store) StarPost(ctx context.Context, arg database.StarPostParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.stars, func(p database.PostStar) bool { return p.ID == arg.ID }) >= 0 {
+		return uniqueViolation("post_stars_pkey")
+	}
+	if find(s.data.users, func(u database.User) bool { return u.ID == arg.UserID }) < 0 || !s.hasPost(arg.PostID) {
+		return errForeignKey
+	}
+	if find(s.data.stars, func(p database.PostStar) bool {
+		return p.UserID == arg.UserID && p.PostID == arg.PostID
+	}) >= 0 {
+		return nil
+	}
+	s.data.stars = append(s.data.stars, database.PostStar(arg))
+	return nil
+}
+
+func (s *Store) UnstarPost(ctx context.Context, arg database.UnstarPostParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.data.stars)
+	s.data.stars = slices.DeleteFunc(s.data.stars, func(p database.PostStar) bool {
+		return p.UserID == arg.UserID && p.PostID == arg.PostID
+	})
+	return int64(before - len(s.data.stars)), nil
+}
+
+// isStarred reports whether anyone starred the post
+func (s *Store) isStarred(postID uuid.UUID) bool {
+	return find(s.data.stars, func(p database.PostStar) bool { return p.PostID == postID }) >= 0
+}
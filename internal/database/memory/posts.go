@@ -0,0 +1,356 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// CountPostsToPrune counts the posts of the feed stored before
+// StoredBefore or not among its newest KeepPosts
+func (s *Store) CountPostsToPrune(ctx context.Context, arg database.CountPostsToPruneParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.postsToPrune(arg.FeedID, arg.StoredBefore, arg.KeepPosts))), nil
+}
+
+func (s *Store) CreatePostCategories(ctx context.Context, arg database.CreatePostCategoriesParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, postID := range arg.PostIds {
+		if !s.hasPost(postID) {
+			return errForeignKey
+		}
+		if find(s.data.categories, func(c database.PostCategory) bool {
+			return c.PostID == postID && c.Name == arg.Names[i]
+		}) >= 0 {
+			continue
+		}
+		s.data.categories = append(s.data.categories, database.PostCategory{
+			ID:        uuid.New(),
+			CreatedAt: arg.Now,
+			PostID:    postID,
+			Name:      arg.Names[i],
+		})
+	}
+	return nil
+}
+
+// A length of 0 and an empty mime type are stored as NULL
+func (s *Store) CreatePostEnclosures(ctx context.Context, arg database.CreatePostEnclosuresParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, postID := range arg.PostIds {
+		if !s.hasPost(postID) {
+			return errForeignKey
+		}
+		if find(s.data.enclosures, func(e database.PostEnclosure) bool {
+			return e.PostID == postID && e.Url == arg.Urls[i]
+		}) >= 0 {
+			continue
+		}
+		s.data.enclosures = append(s.data.enclosures, database.PostEnclosure{
+			ID:        uuid.New(),
+			CreatedAt: arg.Now,
+			PostID:    postID,
+			Url:       arg.Urls[i],
+			Length:    sql.NullInt64{Int64: arg.Lengths[i], Valid: arg.Lengths[i] != 0},
+			MimeType:  nullIfEmpty(arg.MimeTypes[i]),
+		})
+	}
+	return nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id uuid.UUID) (database.GetPostRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, err := one(s.data.posts, func(p database.Post) bool { return p.ID == id })
+	if err != nil {
+		return database.GetPostRow{}, err
+	}
+	return database.GetPostRow(s.postRow(post)), nil
+}
+
+func (s *Store) GetPostCategories(ctx context.Context, postID uuid.UUID) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for _, c := range s.data.categories {
+		if c.PostID == postID {
+			names = append(names, c.Name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (s *Store) GetPostEnclosures(ctx context.Context, postID uuid.UUID) ([]database.PostEnclosure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []database.PostEnclosure
+	for _, e := range s.data.enclosures {
+		if e.PostID == postID {
+			items = append(items, e)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.PostEnclosure) int { return cmp.Compare(a.Url, b.Url) })
+	return items, nil
+}
+
+func (s *Store) GetPostRevisions(ctx context.Context, postID uuid.UUID) ([]database.PostRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []database.PostRevision
+	for _, r := range s.data.revisions {
+		if r.PostID == postID {
+			items = append(items, r)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b database.PostRevision) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return items, nil
+}
+
+// GetPostsForUser returns the newest posts of the feeds the user follows,
+// posts with no published date come first like Postgres DESC
+func (s *Store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []database.GetPostsForUserRow
+	for _, post := range s.data.posts {
+		if find(s.data.feedFollows, func(ff database.FeedFollow) bool {
+			return ff.UserID == arg.UserID && ff.FeedID == post.FeedID
+		}) >= 0 {
+			items = append(items, s.postRow(post))
+		}
+	}
+	slices.SortStableFunc(items, func(a, b database.GetPostsForUserRow) int {
+		if !a.PublishedAt.Valid || !b.PublishedAt.Valid {
+			return compareNullTime(a.PublishedAt, b.PublishedAt)
+		}
+		return b.PublishedAt.Time.Compare(a.PublishedAt.Time)
+	})
+	if len(items) > int(arg.Limit) {
+		items = items[:max(arg.Limit, 0)]
+	}
+	return items, nil
+}
+
+// DeletePostsToPrune deletes up to BatchSize of the posts CountPostsToPrune
+// counts, along with their categories, enclosures, revisions, reads and stars,
+// and remembers their guids so UpsertPosts skips them
+func (s *Store) DeletePostsToPrune(ctx context.Context, arg database.DeletePostsToPruneParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.postsToPrune(arg.FeedID, arg.StoredBefore, arg.KeepPosts)
+	ids = ids[:min(len(ids), max(int(arg.BatchSize), 0))]
+	for _, post := range s.data.posts {
+		if !slices.Contains(ids, post.ID) {
+			continue
+		}
+		s.data.pruned = slices.DeleteFunc(s.data.pruned, func(p database.PrunedPost) bool {
+			return p.FeedID == post.FeedID && p.Guid == post.Guid
+		})
+		s.data.pruned = append(s.data.pruned, database.PrunedPost{FeedID: post.FeedID, Guid: post.Guid, PrunedAt: arg.Now})
+	}
+	s.data.posts = slices.DeleteFunc(s.data.posts, func(p database.Post) bool { return slices.Contains(ids, p.ID) })
+	s.data.categories = slices.DeleteFunc(s.data.categories, func(c database.PostCategory) bool { return slices.Contains(ids, c.PostID) })
+	s.data.enclosures = slices.DeleteFunc(s.data.enclosures, func(e database.PostEnclosure) bool { return slices.Contains(ids, e.PostID) })
+	s.data.revisions = slices.DeleteFunc(s.data.revisions, func(r database.PostRevision) bool { return slices.Contains(ids, r.PostID) })
+	s.data.reads = slices.DeleteFunc(s.data.reads, func(r database.PostRead) bool { return slices.Contains(ids, r.PostID) })
+	s.data.stars = slices.DeleteFunc(s.data.stars, func(p database.PostStar) bool { return slices.Contains(ids, p.PostID) })
+	return int64(len(ids)), nil
+}
+
+// postsToPrune ranks the posts of a feed newest first, by publish date or
+// else when they were stored, and returns the ones to prune. Starred posts
+// and posts someone following the feed hasn't read count towards keepPosts
+// but are never pruned
+func (s *Store) postsToPrune(feedID uuid.UUID, storedBefore time.Time, keepPosts int32) []uuid.UUID {
+	var posts []database.Post
+	for _, post := range s.data.posts {
+		if post.FeedID == feedID {
+			posts = append(posts, post)
+		}
+	}
+	newest := func(p database.Post) time.Time {
+		if p.PublishedAt.Valid {
+			return p.PublishedAt.Time
+		}
+		return p.CreatedAt
+	}
+	slices.SortFunc(posts, func(a, b database.Post) int {
+		return cmp.Or(newest(b).Compare(newest(a)), strings.Compare(a.ID.String(), b.ID.String()))
+	})
+
+	var ids []uuid.UUID
+	for i, post := range posts {
+		if s.isStarred(post.ID) || s.isUnread(post) {
+			continue
+		}
+		if post.CreatedAt.Before(storedBefore) || (keepPosts > 0 && i >= int(keepPosts)) {
+			ids = append(ids, post.ID)
+		}
+	}
+	return ids
+}
+
+// GetRecentPublishTimes returns the newest publish dates of the feed's posts
+// that aren't after now
+func (s *Store) GetRecentPublishTimes(ctx context.Context, arg database.GetRecentPublishTimesParams) ([]sql.NullTime, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []sql.NullTime
+	for _, post := range s.data.posts {
+		if post.FeedID == arg.FeedID && post.PublishedAt.Valid && !post.PublishedAt.Time.After(arg.Now) {
+			items = append(items, post.PublishedAt)
+		}
+	}
+	slices.SortFunc(items, func(a, b sql.NullTime) int { return b.Time.Compare(a.Time) })
+	if len(items) > int(arg.MaxPosts) {
+		items = items[:max(arg.MaxPosts, 0)]
+	}
+	return items, nil
+}
+
+// TakeLegacyGuidFeed always returns 0, the memory store never has posts
+// from before guids were used
+func (s *Store) TakeLegacyGuidFeed(ctx context.Context, feedID uuid.UUID) (int64, error) {
+	return 0, nil
+}
+
+// UpdateLegacyPostGuids gives the posts stored with their url as guid the
+// guid the feed now gives them, unless the feed already has a post with it
+func (s *Store) UpdateLegacyPostGuids(ctx context.Context, arg database.UpdateLegacyPostGuidsParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for i, guid := range arg.Guids {
+		if find(s.data.posts, func(p database.Post) bool { return p.FeedID == arg.FeedID && p.Guid == guid }) >= 0 {
+			continue
+		}
+		j := find(s.data.posts, func(p database.Post) bool {
+			return p.FeedID == arg.FeedID && p.Url == arg.Urls[i] && p.Guid == p.Url
+		})
+		if j < 0 {
+			continue
+		}
+		s.data.posts[j].Guid = guid
+		total++
+	}
+	return total, nil
+}
+
+// UpsertPosts inserts the new posts and updates the ones whose content hash
+// changed, saving their old version as a revision unless it has no hash.
+// Unchanged and pruned posts return no row
+func (s *Store) UpsertPosts(ctx context.Context, arg database.UpsertPostsParams) ([]database.UpsertPostsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.feeds, func(f database.Feed) bool { return f.ID == arg.FeedID }) < 0 {
+		return nil, errForeignKey
+	}
+
+	var items []database.UpsertPostsRow
+	for i, guid := range arg.Guids {
+		var publishedAt sql.NullTime
+		if !arg.PublishedAts[i].IsZero() {
+			publishedAt = sql.NullTime{Time: arg.PublishedAts[i], Valid: true}
+		}
+
+		if s.isPruned(arg.FeedID, guid) {
+			continue
+		}
+
+		j := find(s.data.posts, func(p database.Post) bool { return p.FeedID == arg.FeedID && p.Guid == guid })
+		if j < 0 {
+			s.data.posts = append(s.data.posts, database.Post{
+				ID:          arg.Ids[i],
+				CreatedAt:   arg.Now,
+				UpdatedAt:   arg.Now,
+				Title:       arg.Titles[i],
+				Url:         arg.Urls[i],
+				Description: nullIfEmpty(arg.Descriptions[i]),
+				PublishedAt: publishedAt,
+				FeedID:      arg.FeedID,
+				Content:     nullIfEmpty(arg.Contents[i]),
+				Guid:        guid,
+				Author:      nullIfEmpty(arg.Authors[i]),
+				ContentHash: arg.ContentHashes[i],
+			})
+			items = append(items, database.UpsertPostsRow{ID: arg.Ids[i], Guid: guid, Inserted: true})
+			continue
+		}
+
+		post := &s.data.posts[j]
+		if post.ContentHash == arg.ContentHashes[i] {
+			continue
+		}
+		if post.ContentHash != "" {
+			s.data.revisions = append(s.data.revisions, database.PostRevision{
+				ID:          uuid.New(),
+				CreatedAt:   arg.Now,
+				PostID:      post.ID,
+				Title:       post.Title,
+				Description: post.Description,
+				Content:     post.Content,
+				PublishedAt: post.PublishedAt,
+				ContentHash: post.ContentHash,
+			})
+		}
+		post.UpdatedAt = arg.Now
+		post.Title = arg.Titles[i]
+		post.Description = nullIfEmpty(arg.Descriptions[i])
+		post.Content = nullIfEmpty(arg.Contents[i])
+		post.PublishedAt = publishedAt
+		post.ContentHash = arg.ContentHashes[i]
+		items = append(items, database.UpsertPostsRow{ID: post.ID, Guid: guid, Inserted: false})
+	}
+	return items, nil
+}
+
+func (s *Store) hasPost(id uuid.UUID) bool {
+	return find(s.data.posts, func(p database.Post) bool { return p.ID == id }) >= 0
+}
+
+// postRow joins a post with the name of its feed
+func (s *Store) postRow(post database.Post) database.GetPostsForUserRow {
+	feed, _ := one(s.data.feeds, func(f database.Feed) bool { return f.ID == post.FeedID })
+	return database.GetPostsForUserRow{
+		ID:          post.ID,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		Title:       post.Title,
+		Url:         post.Url,
+		Description: post.Description,
+		PublishedAt: post.PublishedAt,
+		FeedID:      post.FeedID,
+		Content:     post.Content,
+		Guid:        post.Guid,
+		Author:      post.Author,
+		ContentHash: post.ContentHash,
+		FeedName:    feed.Name,
+	}
+}
+
+// nullIfEmpty stores an empty string as NULL, like NULLIF does in Postgres
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
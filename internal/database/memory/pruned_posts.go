@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (s *Store) ForgetPrunedPosts(ctx context.Context, arg database.ForgetPrunedPostsParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.data.pruned)
+	s.data.pruned = slices.DeleteFunc(s.data.pruned, func(p database.PrunedPost) bool {
+		return p.FeedID == arg.FeedID && !slices.Contains(arg.Guids, p.Guid)
+	})
+	return int64(before - len(s.data.pruned)), nil
+}
+
+// isPruned reports whether prune deleted the post with the guid from the feed
+func (s *Store) isPruned(feedID uuid.UUID, guid string) bool {
+	return find(s.data.pruned, func(p database.PrunedPost) bool { return p.FeedID == feedID && p.Guid == guid }) >= 0
+}
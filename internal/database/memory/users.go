@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// ClearUsers deletes every user, which cascades to everything else
+func (s *Store) ClearUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = &data{}
+	return nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if find(s.data.users, func(u database.User) bool { return u.ID == arg.ID }) >= 0 {
+		return database.User{}, uniqueViolation("users_pkey")
+	}
+	if find(s.data.users, func(u database.User) bool { return u.Name == arg.Name }) >= 0 {
+		return database.User{}, uniqueViolation("users_name_key")
+	}
+
+	user := database.User{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Name:      arg.Name,
+	}
+	s.data.users = append(s.data.users, user)
+	return user, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, name string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return one(s.data.users, func(u database.User) bool { return u.Name == name })
+}
+
+func (s *Store) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return one(s.data.users, func(u database.User) bool { return u.ID == id })
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.data.users), nil
+}
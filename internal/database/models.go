@@ -12,13 +12,34 @@ import (
 )
 
 type Feed struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Name           string
+	Url            string
+	UserID         uuid.UUID
+	LastFetchedAt  sql.NullTime
+	LastFetchError sql.NullString
+	FetchInterval  sql.NullInt32
+	Ttl            sql.NullInt32
+	SkipHours      int32
+	SkipDays       int32
+	NextFetchAt    sql.NullTime
+	ScheduleReason sql.NullString
+	RetentionDays  sql.NullInt32
+	RetentionPosts sql.NullInt32
+}
+
+type FeedFetch struct {
 	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	FeedID        uuid.UUID
+	StartedAt     time.Time
+	DurationMs    int32
+	HttpStatus    sql.NullInt32
+	Bytes         int64
+	ItemsParsed   int32
+	PostsInserted int32
+	Error         sql.NullString
 }
 
 type FeedFollow struct {
@@ -29,6 +50,10 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type LegacyGuidFeed struct {
+	FeedID uuid.UUID
+}
+
 type Post struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
@@ -38,6 +63,57 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	Guid        string
+	Author      sql.NullString
+	ContentHash string
+}
+
+type PostCategory struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	PostID    uuid.UUID
+	Name      string
+}
+
+type PostEnclosure struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	PostID    uuid.UUID
+	Url       string
+	Length    sql.NullInt64
+	MimeType  sql.NullString
+}
+
+type PostRead struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+}
+
+type PostRevision struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	PostID      uuid.UUID
+	Title       string
+	Description sql.NullString
+	Content     sql.NullString
+	PublishedAt sql.NullTime
+	ContentHash string
+}
+
+type PostStar struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+}
+
+type PrunedPost struct {
+	FeedID   uuid.UUID
+	Guid     string
+	PrunedAt time.Time
 }
 
 type User struct {
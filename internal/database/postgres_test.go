@@ -0,0 +1,36 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/storetest"
+)
+
+// testDBURLEnv points at a migrated Postgres DB the tests can write to, the
+// tests are skipped when it isn't set
+const testDBURLEnv = "GATOR_TEST_DB_URL"
+
+func TestPostgresStore(t *testing.T) {
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		t.Skipf("%s not set", testDBURLEnv)
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		s, err := database.OpenPostgres(dbURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+
+		// Start every test from an empty DB, deleting the users cascades to
+		// everything else
+		if err := s.ClearUsers(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
@@ -11,15 +11,161 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const countPostsToPrune = `-- name: CountPostsToPrune :one
+
+SELECT count(*)
+FROM (
+    SELECT id, created_at, row_number() OVER (ORDER BY COALESCE(published_at, created_at) DESC, id) AS position
+    FROM posts
+    WHERE feed_id = $1::uuid
+) AS ranked
+WHERE (ranked.created_at < $2::timestamp
+OR ($3::int > 0 AND ranked.position > $3::int))
+AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = ranked.id)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = $1::uuid
+    AND NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = ranked.id AND post_reads.user_id = feed_follows.user_id
+    )
+)
+`
+
+type CountPostsToPruneParams struct {
+	FeedID       uuid.UUID
+	StoredBefore time.Time
+	KeepPosts    int32
+}
+
+// The posts of a feed stored before stored_before or not among its newest
+// keep_posts posts, a keep_posts of 0 keeps any number. Newest is by publish
+// date, or when the post was stored if it has none. Posts someone starred
+// and posts someone following the feed hasn't read are never pruned
+func (q *Queries) CountPostsToPrune(ctx context.Context, arg CountPostsToPruneParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPostsToPrune, arg.FeedID, arg.StoredBefore, arg.KeepPosts)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createPostCategories = `-- name: CreatePostCategories :exec
+
+INSERT INTO post_categories (id, created_at, post_id, name)
+SELECT gen_random_uuid(), $1::timestamp, t.post_id, t.name
+FROM unnest($2::uuid[], $3::text[]) AS t(post_id, name)
+ON CONFLICT (post_id, name) DO NOTHING
+`
+
+type CreatePostCategoriesParams struct {
+	Now     time.Time
+	PostIds []uuid.UUID
+	Names   []string
+}
+
+func (q *Queries) CreatePostCategories(ctx context.Context, arg CreatePostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategories, arg.Now, pq.Array(arg.PostIds), pq.Array(arg.Names))
+	return err
+}
+
+const createPostEnclosures = `-- name: CreatePostEnclosures :exec
+
+INSERT INTO post_enclosures (id, created_at, post_id, url, length, mime_type)
+SELECT gen_random_uuid(), $1::timestamp, t.post_id, t.url, NULLIF(t.length, 0), NULLIF(t.mime_type, '')
+FROM unnest($2::uuid[], $3::text[], $4::bigint[], $5::text[]) AS t(post_id, url, length, mime_type)
+ON CONFLICT (post_id, url) DO NOTHING
+`
+
+type CreatePostEnclosuresParams struct {
+	Now       time.Time
+	PostIds   []uuid.UUID
+	Urls      []string
+	Lengths   []int64
+	MimeTypes []string
+}
+
+// A length of 0 and an empty mime type are stored as NULL
+func (q *Queries) CreatePostEnclosures(ctx context.Context, arg CreatePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosures,
+		arg.Now,
+		pq.Array(arg.PostIds),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Lengths),
+		pq.Array(arg.MimeTypes),
+	)
+	return err
+}
+
+const deletePostsToPrune = `-- name: DeletePostsToPrune :execrows
+
+WITH deleted AS (
+    DELETE FROM posts
+    WHERE id IN (
+        SELECT ranked.id
+        FROM (
+            SELECT id, created_at, row_number() OVER (ORDER BY COALESCE(published_at, created_at) DESC, id) AS position
+            FROM posts
+            WHERE feed_id = $1::uuid
+        ) AS ranked
+        WHERE (ranked.created_at < $2::timestamp
+        OR ($3::int > 0 AND ranked.position > $3::int))
+        AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = ranked.id)
+        AND NOT EXISTS (
+            SELECT 1 FROM feed_follows
+            WHERE feed_follows.feed_id = $1::uuid
+            AND NOT EXISTS (
+                SELECT 1 FROM post_reads
+                WHERE post_reads.post_id = ranked.id AND post_reads.user_id = feed_follows.user_id
+            )
+        )
+        LIMIT $4::int
+    )
+    RETURNING feed_id, guid
+)
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+SELECT feed_id, guid, $5::timestamp
+FROM deleted
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET pruned_at = EXCLUDED.pruned_at
+`
+
+type DeletePostsToPruneParams struct {
+	FeedID       uuid.UUID
+	StoredBefore time.Time
+	KeepPosts    int32
+	BatchSize    int32
+	Now          time.Time
+}
+
+// Deletes up to batch_size of the posts CountPostsToPrune counts, so each
+// delete holds its locks briefly. Their guids go in pruned_posts so
+// UpsertPosts doesn't save them again
+func (q *Queries) DeletePostsToPrune(ctx context.Context, arg DeletePostsToPruneParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePostsToPrune,
+		arg.FeedID,
+		arg.StoredBefore,
+		arg.KeepPosts,
+		arg.BatchSize,
+		arg.Now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getPost = `-- name: GetPost :one
+
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.guid, posts.author, posts.content_hash, feeds.name as feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = $1
 `
 
-type CreatePostParams struct {
+type GetPostRow struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
@@ -28,20 +174,16 @@ type CreatePostParams struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	Guid        string
+	Author      sql.NullString
+	ContentHash string
+	FeedName    string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
-	)
-	var i Post
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (GetPostRow, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i GetPostRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -51,13 +193,124 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Content,
+		&i.Guid,
+		&i.Author,
+		&i.ContentHash,
+		&i.FeedName,
 	)
 	return i, err
 }
 
+const getPostCategories = `-- name: GetPostCategories :many
+
+SELECT name FROM post_categories
+WHERE post_id = $1
+ORDER BY name
+`
+
+func (q *Queries) GetPostCategories(ctx context.Context, postID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getPostCategories, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostEnclosures = `-- name: GetPostEnclosures :many
+
+SELECT id, created_at, post_id, url, length, mime_type FROM post_enclosures
+WHERE post_id = $1
+ORDER BY url
+`
+
+func (q *Queries) GetPostEnclosures(ctx context.Context, postID uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getPostEnclosures, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PostID,
+			&i.Url,
+			&i.Length,
+			&i.MimeType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostRevisions = `-- name: GetPostRevisions :many
+
+SELECT id, created_at, post_id, title, description, content, published_at, content_hash FROM post_revisions
+WHERE post_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetPostRevisions(ctx context.Context, postID uuid.UUID) ([]PostRevision, error) {
+	rows, err := q.db.QueryContext(ctx, getPostRevisions, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostRevision
+	for rows.Next() {
+		var i PostRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PostID,
+			&i.Title,
+			&i.Description,
+			&i.Content,
+			&i.PublishedAt,
+			&i.ContentHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
 
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, feeds.name as feed_name
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.guid, posts.author, posts.content_hash, feeds.name as feed_name
 FROM posts
 INNER JOIN feeds ON posts.feed_id = feeds.id
 INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
@@ -80,6 +333,10 @@ type GetPostsForUserRow struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	Guid        string
+	Author      sql.NullString
+	ContentHash string
 	FeedName    string
 }
 
@@ -101,6 +358,10 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Content,
+			&i.Guid,
+			&i.Author,
+			&i.ContentHash,
 			&i.FeedName,
 		); err != nil {
 			return nil, err
@@ -115,3 +376,187 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getRecentPublishTimes = `-- name: GetRecentPublishTimes :many
+
+SELECT published_at FROM posts
+WHERE feed_id = $1::uuid AND published_at IS NOT NULL AND published_at <= $2::timestamp
+ORDER BY published_at DESC
+LIMIT $3::int
+`
+
+type GetRecentPublishTimesParams struct {
+	FeedID   uuid.UUID
+	Now      time.Time
+	MaxPosts int32
+}
+
+// The publish dates of the newest posts of a feed, dates after now are
+// left out since they can't be trusted
+func (q *Queries) GetRecentPublishTimes(ctx context.Context, arg GetRecentPublishTimesParams) ([]sql.NullTime, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPublishTimes, arg.FeedID, arg.Now, arg.MaxPosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullTime
+	for rows.Next() {
+		var published_at sql.NullTime
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateLegacyPostGuids = `-- name: UpdateLegacyPostGuids :execrows
+
+UPDATE posts
+SET guid = incoming.guid
+FROM unnest($1::text[], $2::text[]) AS incoming(url, guid)
+WHERE posts.feed_id = $3::uuid
+AND posts.url = incoming.url
+AND posts.guid = posts.url
+AND posts.guid <> incoming.guid
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = $3::uuid AND existing.guid = incoming.guid
+)
+`
+
+type UpdateLegacyPostGuidsParams struct {
+	Urls   []string
+	Guids  []string
+	FeedID uuid.UUID
+}
+
+// Migration 007 gave the posts without a guid their raw url as guid, this
+// gives them the guid the feed now gives them, matched by url, so they are
+// updated instead of saved again. A post whose feed already has that guid is
+// left alone
+func (q *Queries) UpdateLegacyPostGuids(ctx context.Context, arg UpdateLegacyPostGuidsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateLegacyPostGuids, pq.Array(arg.Urls), pq.Array(arg.Guids), arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+WITH incoming AS (
+    SELECT id, title, url, description, published_at, content, guid, author, content_hash
+    FROM unnest(
+        $1::uuid[],
+        $2::text[],
+        $3::text[],
+        $4::text[],
+        $5::timestamp[],
+        $6::text[],
+        $7::text[],
+        $8::text[],
+        $9::text[]
+    ) AS t(id, title, url, description, published_at, content, guid, author, content_hash)
+),
+revision AS (
+    INSERT INTO post_revisions (id, created_at, post_id, title, description, content, published_at, content_hash)
+    SELECT gen_random_uuid(), $10::timestamp, posts.id, posts.title, posts.description, posts.content, posts.published_at, posts.content_hash
+    FROM posts
+    INNER JOIN incoming ON incoming.guid = posts.guid
+    WHERE posts.feed_id = $11::uuid
+    AND posts.content_hash <> '' AND posts.content_hash <> incoming.content_hash
+)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, guid, author, content_hash)
+SELECT
+    incoming.id,
+    $10::timestamp,
+    $10::timestamp,
+    incoming.title,
+    incoming.url,
+    NULLIF(incoming.description, ''),
+    NULLIF(incoming.published_at, '0001-01-01 00:00:00'::timestamp),
+    $11::uuid,
+    NULLIF(incoming.content, ''),
+    incoming.guid,
+    NULLIF(incoming.author, ''),
+    incoming.content_hash
+FROM incoming
+WHERE NOT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE pruned_posts.feed_id = $11::uuid AND pruned_posts.guid = incoming.guid
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    published_at = EXCLUDED.published_at,
+    content_hash = EXCLUDED.content_hash
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING posts.id, posts.guid, (xmax = 0) AS inserted
+`
+
+type UpsertPostsParams struct {
+	Ids           []uuid.UUID
+	Titles        []string
+	Urls          []string
+	Descriptions  []string
+	PublishedAts  []time.Time
+	Contents      []string
+	Guids         []string
+	Authors       []string
+	ContentHashes []string
+	Now           time.Time
+	FeedID        uuid.UUID
+}
+
+type UpsertPostsRow struct {
+	ID       uuid.UUID
+	Guid     string
+	Inserted bool
+}
+
+// Inserts a batch of posts for a feed, or updates the posts whose content
+// hash changed. The old versions are saved in post_revisions first and
+// unchanged posts return no row. Posts in pruned_posts are skipped. Empty
+// strings and the zero time are NULL
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]UpsertPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.Contents),
+		pq.Array(arg.Guids),
+		pq.Array(arg.Authors),
+		pq.Array(arg.ContentHashes),
+		arg.Now,
+		arg.FeedID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertPostsRow
+	for rows.Next() {
+		var i UpsertPostsRow
+		if err := rows.Scan(&i.ID, &i.Guid, &i.Inserted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
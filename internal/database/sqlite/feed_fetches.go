@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (q *queries) CreateFeedFetch(ctx context.Context, arg database.CreateFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, `
+INSERT INTO feed_fetches (id, feed_id, started_at, duration_ms, http_status, bytes, items_parsed, posts_inserted, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		arg.ID,
+		arg.FeedID,
+		arg.StartedAt,
+		arg.DurationMs,
+		arg.HttpStatus,
+		arg.Bytes,
+		arg.ItemsParsed,
+		arg.PostsInserted,
+		arg.Error,
+	)
+	return wrapErr(err)
+}
+
+func (q *queries) DeleteFeedFetchesBefore(ctx context.Context, startedAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, `DELETE FROM feed_fetches WHERE started_at < ?`, startedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (q *queries) GetFeedFetches(ctx context.Context, arg database.GetFeedFetchesParams) ([]database.FeedFetch, error) {
+	return queryAll(ctx, q.db, scanFeedFetch, `
+SELECT id, feed_id, started_at, duration_ms, http_status, bytes, items_parsed, posts_inserted, error
+FROM feed_fetches
+WHERE feed_id = ?
+ORDER BY started_at DESC
+LIMIT ?`, arg.FeedID, arg.Limit)
+}
+
+func scanFeedFetch(row scanner) (database.FeedFetch, error) {
+	var i database.FeedFetch
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.StartedAt,
+		&i.DurationMs,
+		&i.HttpStatus,
+		&i.Bytes,
+		&i.ItemsParsed,
+		&i.PostsInserted,
+		&i.Error,
+	)
+	return i, err
+}
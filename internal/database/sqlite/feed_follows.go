@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (q *queries) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	_, err := q.db.ExecContext(ctx, `
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id)
+VALUES (?, ?, ?, ?, ?)`,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.UserID,
+		arg.FeedID,
+	)
+	if err != nil {
+		return database.CreateFeedFollowRow{}, wrapErr(err)
+	}
+
+	row := q.db.QueryRowContext(ctx, `
+SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feeds.name, users.name
+FROM feed_follows
+INNER JOIN feeds ON feeds.id = feed_follows.feed_id
+INNER JOIN users ON users.id = feed_follows.user_id
+WHERE feed_follows.id = ?`, arg.ID)
+	var i database.CreateFeedFollowRow
+	err = row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.FeedID,
+		&i.FeedName,
+		&i.UserName,
+	)
+	return i, err
+}
+
+func (q *queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	return queryAll(ctx, q.db, func(row scanner) (database.GetFeedFollowsForUserRow, error) {
+		var i database.GetFeedFollowsForUserRow
+		err := row.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.FeedID,
+			&i.FeedName,
+			&i.UserName,
+		)
+		return i, err
+	}, `
+SELECT feed_follows.id, feed_follows.created_at, feed_follows.updated_at, feed_follows.user_id, feed_follows.feed_id, feeds.name, users.name
+FROM feed_follows
+INNER JOIN feeds ON feeds.id = feed_follows.feed_id
+INNER JOIN users ON users.id = feed_follows.user_id
+WHERE feed_follows.user_id = ?`, userID)
+}
+
+func (q *queries) RemoveFeedFollow(ctx context.Context, arg database.RemoveFeedFollowParams) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM feed_follows WHERE user_id = ? AND feed_id = ?`, arg.UserID, arg.FeedID)
+	return err
+}
@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+const feedColumns = `id, created_at, updated_at, name, url, user_id, last_fetched_at, last_fetch_error, fetch_interval, ttl, skip_hours, skip_days, next_fetch_at, schedule_reason, retention_days, retention_posts`
+
+func scanFeed(row scanner) (database.Feed, error) {
+	var i database.Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.LastFetchError,
+		&i.FetchInterval,
+		&i.Ttl,
+		&i.SkipHours,
+		&i.SkipDays,
+		&i.NextFetchAt,
+		&i.ScheduleReason,
+		&i.RetentionDays,
+		&i.RetentionPosts,
+	)
+	return i, err
+}
+
+func (q *queries) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING `+feedColumns,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Name,
+		arg.Url,
+		arg.UserID,
+	)
+	feed, err := scanFeed(row)
+	return feed, wrapErr(err)
+}
+
+func (q *queries) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT `+feedColumns+` FROM feeds WHERE url = ?`, url)
+	return scanFeed(row)
+}
+
+func (q *queries) GetFeeds(ctx context.Context) ([]database.Feed, error) {
+	return queryAll(ctx, q.db, scanFeed, `SELECT `+feedColumns+` FROM feeds`)
+}
+
+func (q *queries) GetFeedsToFetch(ctx context.Context, now time.Time) ([]database.Feed, error) {
+	return queryAll(ctx, q.db, scanFeed, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= ?
+ORDER BY next_fetch_at ASC NULLS FIRST`, now)
+}
+
+func (q *queries) GetFollowedFeedsToFetch(ctx context.Context, now time.Time) ([]database.Feed, error) {
+	return queryAll(ctx, q.db, scanFeed, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= ?)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST`, now)
+}
+
+func (q *queries) GetNextFeedToFetch(ctx context.Context, now time.Time) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= ?
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1`, now)
+	return scanFeed(row)
+}
+
+func (q *queries) GetNextFollowedFeedToFetch(ctx context.Context, now time.Time) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= ?)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1`, now)
+	return scanFeed(row)
+}
+
+// The user's feeds are matched with EXISTS instead of a join so the columns
+// don't need the table name
+func (q *queries) GetNextUserFeedToFetch(ctx context.Context, arg database.GetNextUserFeedToFetchParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id AND feed_follows.user_id = ?)
+AND (next_fetch_at IS NULL OR next_fetch_at <= ?)
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1`, arg.UserID, arg.Now)
+	return scanFeed(row)
+}
+
+func (q *queries) GetUserFeedsToFetch(ctx context.Context, arg database.GetUserFeedsToFetchParams) ([]database.Feed, error) {
+	return queryAll(ctx, q.db, scanFeed, `
+SELECT `+feedColumns+`
+FROM feeds
+WHERE EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id AND feed_follows.user_id = ?)
+AND (next_fetch_at IS NULL OR next_fetch_at <= ?)
+ORDER BY next_fetch_at ASC NULLS FIRST`, arg.UserID, arg.Now)
+}
+
+func (q *queries) MarkFeedFetchFailed(ctx context.Context, arg database.MarkFeedFetchFailedParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+UPDATE feeds
+SET updated_at = ?, last_fetched_at = ?, last_fetch_error = ?,
+    next_fetch_at = ?, schedule_reason = ?
+WHERE id = ?
+RETURNING `+feedColumns,
+		arg.UpdatedAt,
+		arg.LastFetchedAt,
+		arg.LastFetchError,
+		arg.NextFetchAt,
+		arg.ScheduleReason,
+		arg.ID,
+	)
+	return scanFeed(row)
+}
+
+func (q *queries) MarkFeedFetched(ctx context.Context, arg database.MarkFeedFetchedParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+UPDATE feeds
+SET updated_at = ?, last_fetched_at = ?, last_fetch_error = NULL,
+    next_fetch_at = ?, ttl = ?, skip_hours = ?, skip_days = ?, schedule_reason = ?
+WHERE id = ?
+RETURNING `+feedColumns,
+		arg.UpdatedAt,
+		arg.LastFetchedAt,
+		arg.NextFetchAt,
+		arg.Ttl,
+		arg.SkipHours,
+		arg.SkipDays,
+		arg.ScheduleReason,
+		arg.ID,
+	)
+	return scanFeed(row)
+}
+
+func (q *queries) SetFeedFetchInterval(ctx context.Context, arg database.SetFeedFetchIntervalParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+UPDATE feeds
+SET updated_at = ?, fetch_interval = ?, next_fetch_at = ?, schedule_reason = ?
+WHERE id = ?
+RETURNING `+feedColumns,
+		arg.UpdatedAt,
+		arg.FetchInterval,
+		arg.NextFetchAt,
+		arg.ScheduleReason,
+		arg.ID,
+	)
+	return scanFeed(row)
+}
+
+func (q *queries) SetFeedRetention(ctx context.Context, arg database.SetFeedRetentionParams) (database.Feed, error) {
+	row := q.db.QueryRowContext(ctx, `
+UPDATE feeds
+SET updated_at = ?, retention_days = ?, retention_posts = ?
+WHERE id = ?
+RETURNING `+feedColumns,
+		arg.UpdatedAt,
+		arg.RetentionDays,
+		arg.RetentionPosts,
+		arg.ID,
+	)
+	return scanFeed(row)
+}
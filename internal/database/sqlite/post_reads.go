@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (q *queries) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	_, err := q.db.ExecContext(ctx, `
+INSERT INTO post_reads (id, created_at, user_id, post_id)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id, post_id) DO NOTHING`,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.PostID,
+	)
+	return wrapErr(err)
+}
+
+func (q *queries) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, `DELETE FROM post_reads WHERE user_id = ? AND post_id = ?`, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func (q *queries) IsPostStarred(ctx context.Context, arg database.IsPostStarredParams) (bool, error) {
+	var exists bool
+	err := q.db.QueryRowContext(ctx, `
+SELECT EXISTS (SELECT 1 FROM post_stars WHERE user_id = ? AND post_id = ?)`, arg.UserID, arg.PostID).Scan(&exists)
+	return exists, err
+}
+
+func (q *queries) StarPost(ctx context.Context, arg database.StarPostParams) error {
+	_, err := q.db.ExecContext(ctx, `
+INSERT INTO post_stars (id, created_at, user_id, post_id)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id, post_id) DO NOTHING`,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UserID,
+		arg.PostID,
+	)
+	return wrapErr(err)
+}
+
+func (q *queries) UnstarPost(ctx context.Context, arg database.UnstarPostParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, `DELETE FROM post_stars WHERE user_id = ? AND post_id = ?`, arg.UserID, arg.PostID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
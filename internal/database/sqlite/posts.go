@@ -0,0 +1,349 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+const postColumns = `posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.content, posts.guid, posts.author, posts.content_hash, feeds.name`
+
+func (q *queries) CreatePostCategories(ctx context.Context, arg database.CreatePostCategoriesParams) error {
+	for i := range arg.PostIds {
+		_, err := q.db.ExecContext(ctx, `
+INSERT INTO post_categories (id, created_at, post_id, name)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (post_id, name) DO NOTHING`,
+			uuid.New(),
+			arg.Now,
+			arg.PostIds[i],
+			arg.Names[i],
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A length of 0 and an empty mime type are stored as NULL
+func (q *queries) CreatePostEnclosures(ctx context.Context, arg database.CreatePostEnclosuresParams) error {
+	for i := range arg.PostIds {
+		_, err := q.db.ExecContext(ctx, `
+INSERT INTO post_enclosures (id, created_at, post_id, url, length, mime_type)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (post_id, url) DO NOTHING`,
+			uuid.New(),
+			arg.Now,
+			arg.PostIds[i],
+			arg.Urls[i],
+			sql.NullInt64{Int64: arg.Lengths[i], Valid: arg.Lengths[i] != 0},
+			nullIfEmpty(arg.MimeTypes[i]),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *queries) GetPost(ctx context.Context, id uuid.UUID) (database.GetPostRow, error) {
+	row := q.db.QueryRowContext(ctx, `
+SELECT `+postColumns+`
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = ?`, id)
+	var i database.GetPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		&i.Guid,
+		&i.Author,
+		&i.ContentHash,
+		&i.FeedName,
+	)
+	return i, err
+}
+
+func (q *queries) GetPostCategories(ctx context.Context, postID uuid.UUID) ([]string, error) {
+	return queryAll(ctx, q.db, func(row scanner) (string, error) {
+		var name string
+		err := row.Scan(&name)
+		return name, err
+	}, `SELECT name FROM post_categories WHERE post_id = ? ORDER BY name`, postID)
+}
+
+func (q *queries) GetPostEnclosures(ctx context.Context, postID uuid.UUID) ([]database.PostEnclosure, error) {
+	return queryAll(ctx, q.db, func(row scanner) (database.PostEnclosure, error) {
+		var i database.PostEnclosure
+		err := row.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PostID,
+			&i.Url,
+			&i.Length,
+			&i.MimeType,
+		)
+		return i, err
+	}, `
+SELECT id, created_at, post_id, url, length, mime_type FROM post_enclosures
+WHERE post_id = ?
+ORDER BY url`, postID)
+}
+
+func (q *queries) GetPostRevisions(ctx context.Context, postID uuid.UUID) ([]database.PostRevision, error) {
+	return queryAll(ctx, q.db, func(row scanner) (database.PostRevision, error) {
+		var i database.PostRevision
+		err := row.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PostID,
+			&i.Title,
+			&i.Description,
+			&i.Content,
+			&i.PublishedAt,
+			&i.ContentHash,
+		)
+		return i, err
+	}, `
+SELECT id, created_at, post_id, title, description, content, published_at, content_hash FROM post_revisions
+WHERE post_id = ?
+ORDER BY created_at DESC`, postID)
+}
+
+// GetPostsForUser puts posts without a published date first like Postgres
+// does for DESC
+func (q *queries) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	return queryAll(ctx, q.db, func(row scanner) (database.GetPostsForUserRow, error) {
+		var i database.GetPostsForUserRow
+		err := row.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.Guid,
+			&i.Author,
+			&i.ContentHash,
+			&i.FeedName,
+		)
+		return i, err
+	}, `
+SELECT `+postColumns+`
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?
+ORDER BY posts.published_at DESC NULLS FIRST
+LIMIT ?`, arg.UserID, arg.Limit)
+}
+
+// postsToPrune ranks the posts of a feed newest first and picks the ones to
+// prune, leaving out starred posts and posts someone following the feed
+// hasn't read. Its parameters are the feed, stored_before and keep_posts twice
+const postsToPrune = `
+SELECT ranked.id
+FROM (
+    SELECT id, feed_id, created_at, row_number() OVER (ORDER BY COALESCE(published_at, created_at) DESC, id) AS position
+    FROM posts
+    WHERE feed_id = ?
+) AS ranked
+WHERE (ranked.created_at < ?
+OR (? > 0 AND ranked.position > ?))
+AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = ranked.id)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = ranked.feed_id
+    AND NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = ranked.id AND post_reads.user_id = feed_follows.user_id
+    )
+)`
+
+func (q *queries) CountPostsToPrune(ctx context.Context, arg database.CountPostsToPruneParams) (int64, error) {
+	var count int64
+	err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM (`+postsToPrune+`)`,
+		arg.FeedID, arg.StoredBefore, arg.KeepPosts, arg.KeepPosts).Scan(&count)
+	return count, err
+}
+
+// DeletePostsToPrune can't delete and insert in one statement like Postgres
+// does, so it picks the batch once and then adds a pruned_posts row for and
+// deletes each of those posts
+func (q *queries) DeletePostsToPrune(ctx context.Context, arg database.DeletePostsToPruneParams) (int64, error) {
+	ids, err := queryAll(ctx, q.db, func(row scanner) (uuid.UUID, error) {
+		var id uuid.UUID
+		err := row.Scan(&id)
+		return id, err
+	}, `SELECT id FROM (`+postsToPrune+`) LIMIT ?`,
+		arg.FeedID, arg.StoredBefore, arg.KeepPosts, arg.KeepPosts, arg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, id := range ids {
+		_, err := q.db.ExecContext(ctx, `
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+SELECT feed_id, guid, ? FROM posts WHERE id = ?
+ON CONFLICT (feed_id, guid) DO UPDATE SET pruned_at = excluded.pruned_at`, arg.Now, id)
+		if err != nil {
+			return total, err
+		}
+
+		result, err := q.db.ExecContext(ctx, `DELETE FROM posts WHERE id = ?`, id)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (q *queries) GetRecentPublishTimes(ctx context.Context, arg database.GetRecentPublishTimesParams) ([]sql.NullTime, error) {
+	return queryAll(ctx, q.db, func(row scanner) (sql.NullTime, error) {
+		var publishedAt sql.NullTime
+		err := row.Scan(&publishedAt)
+		return publishedAt, err
+	}, `
+SELECT published_at FROM posts
+WHERE feed_id = ? AND published_at IS NOT NULL AND published_at <= ?
+ORDER BY published_at DESC
+LIMIT ?`, arg.FeedID, arg.Now, arg.MaxPosts)
+}
+
+func (q *queries) TakeLegacyGuidFeed(ctx context.Context, feedID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, `DELETE FROM legacy_guid_feeds WHERE feed_id = ?`, feedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (q *queries) UpdateLegacyPostGuids(ctx context.Context, arg database.UpdateLegacyPostGuidsParams) (int64, error) {
+	var total int64
+	for i := range arg.Urls {
+		result, err := q.db.ExecContext(ctx, `
+UPDATE posts
+SET guid = ?
+WHERE feed_id = ? AND url = ? AND guid = url AND guid <> ?
+AND NOT EXISTS (SELECT 1 FROM posts AS existing WHERE existing.feed_id = ? AND existing.guid = ?)`,
+			arg.Guids[i], arg.FeedID, arg.Urls[i], arg.Guids[i], arg.FeedID, arg.Guids[i])
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// UpsertPosts does one post at a time, SQLite has no arrays to unnest and
+// can't tell inserted rows from updated ones in RETURNING. It matches the
+// Postgres query: changed posts get a revision of the old version first,
+// unchanged and pruned posts return no row
+func (q *queries) UpsertPosts(ctx context.Context, arg database.UpsertPostsParams) ([]database.UpsertPostsRow, error) {
+	var items []database.UpsertPostsRow
+	for i := range arg.Ids {
+		var publishedAt sql.NullTime
+		if !arg.PublishedAts[i].IsZero() {
+			publishedAt = sql.NullTime{Time: arg.PublishedAts[i], Valid: true}
+		}
+
+		var pruned bool
+		err := q.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pruned_posts WHERE feed_id = ? AND guid = ?)`, arg.FeedID, arg.Guids[i]).Scan(&pruned)
+		if err != nil {
+			return nil, err
+		}
+		if pruned {
+			continue
+		}
+
+		var id uuid.UUID
+		var oldHash string
+		err = q.db.QueryRowContext(ctx, `SELECT id, content_hash FROM posts WHERE feed_id = ? AND guid = ?`, arg.FeedID, arg.Guids[i]).Scan(&id, &oldHash)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = q.db.ExecContext(ctx, `
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, guid, author, content_hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				arg.Ids[i],
+				arg.Now,
+				arg.Now,
+				arg.Titles[i],
+				arg.Urls[i],
+				nullIfEmpty(arg.Descriptions[i]),
+				publishedAt,
+				arg.FeedID,
+				nullIfEmpty(arg.Contents[i]),
+				arg.Guids[i],
+				nullIfEmpty(arg.Authors[i]),
+				arg.ContentHashes[i],
+			)
+			if err != nil {
+				return nil, wrapErr(err)
+			}
+			items = append(items, database.UpsertPostsRow{ID: arg.Ids[i], Guid: arg.Guids[i], Inserted: true})
+			continue
+		case err != nil:
+			return nil, err
+		case oldHash == arg.ContentHashes[i]:
+			continue
+		}
+
+		if oldHash != "" {
+			if err := q.saveRevision(ctx, id, arg.Now); err != nil {
+				return nil, err
+			}
+		}
+		_, err = q.db.ExecContext(ctx, `
+UPDATE posts
+SET updated_at = ?, title = ?, description = ?, content = ?, published_at = ?, content_hash = ?
+WHERE id = ?`,
+			arg.Now,
+			arg.Titles[i],
+			nullIfEmpty(arg.Descriptions[i]),
+			nullIfEmpty(arg.Contents[i]),
+			publishedAt,
+			arg.ContentHashes[i],
+			id,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, database.UpsertPostsRow{ID: id, Guid: arg.Guids[i], Inserted: false})
+	}
+	return items, nil
+}
+
+// saveRevision copies the current version of a post to post_revisions
+func (q *queries) saveRevision(ctx context.Context, postID uuid.UUID, now time.Time) error {
+	_, err := q.db.ExecContext(ctx, `
+INSERT INTO post_revisions (id, created_at, post_id, title, description, content, published_at, content_hash)
+SELECT ?, ?, id, title, description, content, published_at, content_hash
+FROM posts
+WHERE id = ?`, uuid.New(), now, postID)
+	return err
+}
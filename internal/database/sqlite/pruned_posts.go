@@ -0,0 +1,38 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// ForgetPrunedPosts deletes the rows one at a time, SQLite has no arrays to
+// compare the guids with
+func (q *queries) ForgetPrunedPosts(ctx context.Context, arg database.ForgetPrunedPostsParams) (int64, error) {
+	guids, err := queryAll(ctx, q.db, func(row scanner) (string, error) {
+		var guid string
+		err := row.Scan(&guid)
+		return guid, err
+	}, `SELECT guid FROM pruned_posts WHERE feed_id = ?`, arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, guid := range guids {
+		if slices.Contains(arg.Guids, guid) {
+			continue
+		}
+		result, err := q.db.ExecContext(ctx, `DELETE FROM pruned_posts WHERE feed_id = ? AND guid = ?`, arg.FeedID, guid)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,198 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order, the number of applied migrations is kept
+// in PRAGMA user_version. The schema matches sql/schema, add a new entry
+// here whenever a migration is added there
+var migrations = []string{
+	// 001_users.sql to 008_post_revisions.sql
+	`
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE feeds (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT UNIQUE NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_fetched_at TIMESTAMP
+);
+
+CREATE TABLE feed_follows (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    UNIQUE (user_id, feed_id)
+);
+
+CREATE TABLE posts (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    published_at TIMESTAMP,
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    content TEXT,
+    guid TEXT NOT NULL,
+    author TEXT,
+    content_hash TEXT NOT NULL DEFAULT '',
+    UNIQUE (feed_id, guid)
+);
+
+CREATE TABLE post_categories (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE (post_id, name)
+);
+
+CREATE TABLE post_enclosures (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    length INTEGER,
+    mime_type TEXT,
+    UNIQUE (post_id, url)
+);
+
+CREATE TABLE post_revisions (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT,
+    published_at TIMESTAMP,
+    content_hash TEXT NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_idx ON post_revisions (post_id);
+`,
+	// 009_feeds_last_fetch_error.sql
+	`
+ALTER TABLE feeds ADD COLUMN last_fetch_error TEXT;
+`,
+	// 010_feeds_schedule.sql
+	`
+ALTER TABLE feeds ADD COLUMN fetch_interval INTEGER;
+ALTER TABLE feeds ADD COLUMN ttl INTEGER;
+ALTER TABLE feeds ADD COLUMN skip_hours INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN skip_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN next_fetch_at TIMESTAMP;
+
+CREATE INDEX feeds_next_fetch_at_idx ON feeds (next_fetch_at);
+`,
+	// 011_feeds_schedule_reason.sql
+	`
+ALTER TABLE feeds ADD COLUMN schedule_reason TEXT;
+`,
+	// 012_feed_fetches.sql
+	`
+CREATE TABLE feed_fetches (
+    id TEXT PRIMARY KEY,
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    http_status INTEGER,
+    bytes INTEGER NOT NULL,
+    items_parsed INTEGER NOT NULL,
+    posts_inserted INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX feed_fetches_feed_id_started_at_idx ON feed_fetches (feed_id, started_at);
+CREATE INDEX feed_fetches_started_at_idx ON feed_fetches (started_at);
+`,
+	// 013_feeds_retention.sql
+	`
+ALTER TABLE feeds ADD COLUMN retention_days INTEGER;
+ALTER TABLE feeds ADD COLUMN retention_posts INTEGER;
+`,
+	// 014_post_stars.sql
+	`
+CREATE TABLE post_stars (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    UNIQUE (user_id, post_id)
+);
+
+CREATE INDEX post_stars_post_id_idx ON post_stars (post_id);
+`,
+	// 015_pruned_posts.sql
+	`
+CREATE TABLE pruned_posts (
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+`,
+	// 016_legacy_guid_feeds.sql
+	`
+CREATE TABLE legacy_guid_feeds (
+    feed_id TEXT PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+INSERT INTO legacy_guid_feeds (feed_id)
+SELECT DISTINCT feed_id FROM posts WHERE guid = url;
+`,
+	// 017_post_reads.sql
+	`
+CREATE TABLE post_reads (
+    id TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id TEXT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    UNIQUE (user_id, post_id)
+);
+
+CREATE INDEX post_reads_post_id_idx ON post_reads (post_id);
+`,
+}
+
+// migrate applies the migrations the DB doesn't have yet
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA doesn't take bind parameters
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
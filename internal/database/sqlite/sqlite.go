@@ -0,0 +1,130 @@
+// Package sqlite is a database.Store backed by SQLite, for running gator
+// without a Postgres server. It implements the same queries as the sqlc
+// generated Postgres code by hand
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	sqlite "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Store is the SQLite database.Store
+type Store struct {
+	*queries
+	db *sql.DB
+}
+
+var _ database.Store = (*Store)(nil)
+
+// queries runs the queries on the DB or on a transaction
+type queries struct {
+	db database.DBTX
+}
+
+var _ database.Querier = (*queries)(nil)
+
+// Open opens the SQLite DB file at path, creating it if needed, and brings
+// its schema up to date
+func Open(path string) (*Store, error) {
+	// Times are written in a fixed UTC format so they sort as text
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	dsn := path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer, a single connection avoids busy errors
+	// and lets in memory DBs be shared by every query
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate the SQLite schema: %w", err)
+	}
+
+	return &Store{
+		queries: &queries{db: db},
+		db:      db,
+	}, nil
+}
+
+func (s *Store) ExecTx(ctx context.Context, fn func(database.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&queries{db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// wrapErr maps SQLite constraint errors to database.ErrUniqueViolation so
+// callers don't have to know the backend
+func wrapErr(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %v", database.ErrUniqueViolation, err)
+		}
+	}
+	return err
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// queryAll runs a query and scans every row with scan
+func queryAll[T any](ctx context.Context, db database.DBTX, scan func(scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// nullIfEmpty stores an empty string as NULL, like NULLIF does in Postgres
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+const userColumns = `id, created_at, updated_at, name`
+
+func scanUser(row scanner) (database.User, error) {
+	var i database.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+	)
+	return i, err
+}
+
+func (q *queries) ClearUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM users`)
+	return err
+}
+
+func (q *queries) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	row := q.db.QueryRowContext(ctx, `
+INSERT INTO users (id, created_at, updated_at, name)
+VALUES (?, ?, ?, ?)
+RETURNING `+userColumns,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Name,
+	)
+	user, err := scanUser(row)
+	return user, wrapErr(err)
+}
+
+func (q *queries) GetUser(ctx context.Context, name string) (database.User, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE name = ? LIMIT 1`, name)
+	return scanUser(row)
+}
+
+func (q *queries) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	row := q.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+	return scanUser(row)
+}
+
+func (q *queries) GetUsers(ctx context.Context) ([]database.User, error) {
+	return queryAll(ctx, q.db, scanUser, `SELECT `+userColumns+` FROM users`)
+}
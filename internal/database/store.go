@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Store is the storage the commands use, the sqlc queries plus transactions.
+// PostgresStore wraps the generated queries, other backends implement the
+// same queries by hand
+type Store interface {
+	Querier
+
+	// ExecTx runs fn in a transaction, which is committed if fn returns nil
+	// and rolled back otherwise
+	ExecTx(ctx context.Context, fn func(Querier) error) error
+
+	// Ping checks the DB can still be reached
+	Ping(ctx context.Context) error
+
+	// Close closes the connection to the DB
+	Close() error
+}
+
+// ErrUniqueViolation is returned, wrapped, by backends other than Postgres
+// when an insert breaks a unique constraint
+var ErrUniqueViolation = errors.New("unique constraint violation")
+
+// IsUniqueViolation reports whether err is a unique constraint violation
+// from any backend
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, ErrUniqueViolation) {
+		return true
+	}
+	var pgerr *pq.Error
+	return errors.As(err, &pgerr) && pgerr.Code == "23505"
+}
+
+// PostgresStore is the Store backed by the sqlc queries
+type PostgresStore struct {
+	*Queries
+	db *sql.DB
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// OpenPostgres connects to the Postgres DB at dbURL
+func OpenPostgres(dbURL string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostgresStore(db), nil
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{
+		Queries: New(db),
+		db:      db,
+	}
+}
+
+func (s *PostgresStore) ExecTx(ctx context.Context, fn func(Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,1208 @@
+// Package storetest is the contract every database.Store has to meet, each
+// backend runs it from its own tests so they all behave the same
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// Run runs the contract tests, newStore returns an empty store for each test
+func Run(t *testing.T, newStore func(t *testing.T) database.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s database.Store)
+	}{
+		{"Ping", testPing},
+		{"Users", testUsers},
+		{"DuplicateUser", testDuplicateUser},
+		{"Feeds", testFeeds},
+		{"NextFeedToFetch", testNextFeedToFetch},
+		{"FollowedFeedsToFetch", testFollowedFeedsToFetch},
+		{"FeedSchedule", testFeedSchedule},
+		{"FeedFetchError", testFeedFetchError},
+		{"RecentPublishTimes", testRecentPublishTimes},
+		{"FeedFollows", testFeedFollows},
+		{"FeedFetches", testFeedFetches},
+		{"UpsertPosts", testUpsertPosts},
+		{"LegacyPostGuids", testLegacyPostGuids},
+		{"PostsForUser", testPostsForUser},
+		{"PostExtras", testPostExtras},
+		{"PrunePosts", testPrunePosts},
+		{"PostStars", testPostStars},
+		{"PostReads", testPostReads},
+		{"PrunedPosts", testPrunedPosts},
+		{"ExecTxRollback", testExecTxRollback},
+		{"ClearUsers", testClearUsers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// now is truncated to microseconds, the precision Postgres keeps
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func createUser(t *testing.T, s database.Store, name string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+	return user
+}
+
+func createFeed(t *testing.T, s database.Store, user database.User, name string) database.Feed {
+	t.Helper()
+	feed, err := s.CreateFeed(context.Background(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		Name:      name,
+		Url:       "https://example.com/" + uuid.NewString(),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed(%s): %v", name, err)
+	}
+	return feed
+}
+
+func follow(t *testing.T, s database.Store, user database.User, feed database.Feed) database.CreateFeedFollowRow {
+	t.Helper()
+	row, err := s.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeedFollow: %v", err)
+	}
+	return row
+}
+
+// testPost is one post given to UpsertPosts
+type testPost struct {
+	guid string
+	// url is the link, https://example.com/posts/<guid> when empty
+	url         string
+	title       string
+	description string
+	publishedAt time.Time
+	hash        string
+}
+
+func upsert(t *testing.T, s database.Querier, feed database.Feed, at time.Time, posts ...testPost) []database.UpsertPostsRow {
+	t.Helper()
+	arg := database.UpsertPostsParams{Now: at, FeedID: feed.ID}
+	for _, p := range posts {
+		arg.Ids = append(arg.Ids, uuid.New())
+		arg.Titles = append(arg.Titles, p.title)
+		url := p.url
+		if url == "" {
+			url = "https://example.com/posts/" + p.guid
+		}
+		arg.Urls = append(arg.Urls, url)
+		arg.Descriptions = append(arg.Descriptions, p.description)
+		arg.PublishedAts = append(arg.PublishedAts, p.publishedAt)
+		arg.Contents = append(arg.Contents, "")
+		arg.Guids = append(arg.Guids, p.guid)
+		arg.Authors = append(arg.Authors, "")
+		arg.ContentHashes = append(arg.ContentHashes, p.hash)
+	}
+	rows, err := s.UpsertPosts(context.Background(), arg)
+	if err != nil {
+		t.Fatalf("UpsertPosts: %v", err)
+	}
+	return rows
+}
+
+func testPing(t *testing.T, s database.Store) {
+	if err := s.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
+
+func testUsers(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	createUser(t, s, "bob")
+
+	got, err := s.GetUser(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.ID != alice.ID || got.Name != "alice" || !got.CreatedAt.Equal(alice.CreatedAt) {
+		t.Errorf("GetUser = %+v, want %+v", got, alice)
+	}
+
+	got, err = s.GetUserById(ctx, alice.ID)
+	if err != nil || got.Name != "alice" {
+		t.Errorf("GetUserById = %+v, %v, want alice", got, err)
+	}
+
+	if _, err := s.GetUser(ctx, "carol"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser of a missing user: got %v, want sql.ErrNoRows", err)
+	}
+
+	users, err := s.GetUsers(ctx)
+	if err != nil {
+		t.Fatalf("GetUsers: %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("GetUsers returned %d users, want 2", len(users))
+	}
+}
+
+func testDuplicateUser(t *testing.T, s database.Store) {
+	createUser(t, s, "alice")
+	_, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		Name:      "alice",
+	})
+	if !database.IsUniqueViolation(err) {
+		t.Errorf("CreateUser of a duplicate name: got %v, want a unique violation", err)
+	}
+}
+
+func testFeeds(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	if feed.LastFetchedAt.Valid {
+		t.Errorf("new feed has last_fetched_at %v, want NULL", feed.LastFetchedAt.Time)
+	}
+
+	got, err := s.GetFeedByUrl(ctx, feed.Url)
+	if err != nil || got.ID != feed.ID || got.UserID != user.ID {
+		t.Errorf("GetFeedByUrl = %+v, %v, want %+v", got, err, feed)
+	}
+
+	_, err = s.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		Name:      "copy",
+		Url:       feed.Url,
+		UserID:    user.ID,
+	})
+	if !database.IsUniqueViolation(err) {
+		t.Errorf("CreateFeed of a duplicate url: got %v, want a unique violation", err)
+	}
+
+	fetchedAt := now()
+	marked, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:            feed.ID,
+		UpdatedAt:     fetchedAt,
+		LastFetchedAt: sql.NullTime{Time: fetchedAt, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkFeedFetched: %v", err)
+	}
+	if !marked.LastFetchedAt.Valid || !marked.LastFetchedAt.Time.Equal(fetchedAt) {
+		t.Errorf("MarkFeedFetched set last_fetched_at to %v, want %v", marked.LastFetchedAt, fetchedAt)
+	}
+
+	feeds, err := s.GetFeeds(ctx)
+	if err != nil || len(feeds) != 1 {
+		t.Errorf("GetFeeds = %d feeds, %v, want 1", len(feeds), err)
+	}
+}
+
+func testNextFeedToFetch(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	soon := createFeed(t, s, user, "soon")
+	later := createFeed(t, s, user, "later")
+	never := createFeed(t, s, user, "never")
+	notDue := createFeed(t, s, user, "not due")
+
+	schedule := func(feed database.Feed, next time.Time) {
+		t.Helper()
+		_, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID:            feed.ID,
+			UpdatedAt:     now(),
+			LastFetchedAt: sql.NullTime{Time: now(), Valid: true},
+			NextFetchAt:   sql.NullTime{Time: next, Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("MarkFeedFetched: %v", err)
+		}
+	}
+	start := now()
+	schedule(soon, start.Add(-2*time.Hour))
+	schedule(later, start.Add(-time.Hour))
+	schedule(notDue, start.Add(time.Hour))
+
+	due, err := s.GetFeedsToFetch(ctx, start)
+	if err != nil {
+		t.Fatalf("GetFeedsToFetch: %v", err)
+	}
+	var dueNames []string
+	for _, feed := range due {
+		dueNames = append(dueNames, feed.Name)
+	}
+	if !slices.Equal(dueNames, []string{"never", "soon", "later"}) {
+		t.Errorf("GetFeedsToFetch = %q, want never, soon, later", dueNames)
+	}
+
+	// Feeds that were never fetched come first, then the earliest
+	// next_fetch_at, feeds that aren't due yet are left out
+	for _, want := range []database.Feed{never, soon, later} {
+		got, err := s.GetNextFeedToFetch(ctx, start)
+		if err != nil {
+			t.Fatalf("GetNextFeedToFetch: %v", err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("GetNextFeedToFetch = %s, want %s", got.Name, want.Name)
+		}
+		schedule(got, start.Add(2*time.Hour))
+	}
+	if got, err := s.GetNextFeedToFetch(ctx, start); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("GetNextFeedToFetch with nothing due = %s, %v, want sql.ErrNoRows", got.Name, err)
+	}
+
+	// A feed due exactly now is fetched
+	got, err := s.GetNextFeedToFetch(ctx, start.Add(time.Hour))
+	if err != nil || got.ID != notDue.ID {
+		t.Fatalf("GetNextFeedToFetch = %s, %v, want %s", got.Name, err, notDue.Name)
+	}
+}
+
+func testFollowedFeedsToFetch(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	aliceFeed := createFeed(t, s, alice, "alice's")
+	bobFeed := createFeed(t, s, bob, "bob's")
+	shared := createFeed(t, s, alice, "shared")
+	createFeed(t, s, alice, "orphan")
+	follow(t, s, alice, aliceFeed)
+	follow(t, s, alice, shared)
+	follow(t, s, bob, bobFeed)
+	follow(t, s, bob, shared)
+
+	names := func(feeds []database.Feed) []string {
+		var names []string
+		for _, feed := range feeds {
+			names = append(names, feed.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+	start := now()
+
+	// Feeds nobody follows are left out, shared ones are listed once
+	followed, err := s.GetFollowedFeedsToFetch(ctx, start)
+	if err != nil {
+		t.Fatalf("GetFollowedFeedsToFetch: %v", err)
+	}
+	if got := names(followed); !slices.Equal(got, []string{"alice's", "bob's", "shared"}) {
+		t.Errorf("GetFollowedFeedsToFetch = %q, want alice's, bob's, shared", got)
+	}
+	aliceDue, err := s.GetUserFeedsToFetch(ctx, database.GetUserFeedsToFetchParams{UserID: alice.ID, Now: start})
+	if err != nil {
+		t.Fatalf("GetUserFeedsToFetch: %v", err)
+	}
+	if got := names(aliceDue); !slices.Equal(got, []string{"alice's", "shared"}) {
+		t.Errorf("GetUserFeedsToFetch(alice) = %q, want alice's, shared", got)
+	}
+
+	// Fetching a feed makes it not due for either of them
+	for _, feed := range []database.Feed{aliceFeed, shared} {
+		_, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+			ID:            feed.ID,
+			UpdatedAt:     start,
+			LastFetchedAt: sql.NullTime{Time: start, Valid: true},
+			NextFetchAt:   sql.NullTime{Time: start.Add(time.Hour), Valid: true},
+		})
+		if err != nil {
+			t.Fatalf("MarkFeedFetched: %v", err)
+		}
+	}
+	if got, err := s.GetNextUserFeedToFetch(ctx, database.GetNextUserFeedToFetchParams{UserID: alice.ID, Now: start}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetNextUserFeedToFetch(alice) with nothing due = %s, %v, want sql.ErrNoRows", got.Name, err)
+	}
+	if got, err := s.GetNextUserFeedToFetch(ctx, database.GetNextUserFeedToFetchParams{UserID: bob.ID, Now: start}); err != nil || got.ID != bobFeed.ID {
+		t.Errorf("GetNextUserFeedToFetch(bob) = %s, %v, want bob's", got.Name, err)
+	}
+	if got, err := s.GetNextFollowedFeedToFetch(ctx, start); err != nil || got.ID != bobFeed.ID {
+		t.Errorf("GetNextFollowedFeedToFetch = %s, %v, want bob's", got.Name, err)
+	}
+
+	// Once nobody follows a feed it isn't fetched any more
+	for _, user := range []database.User{alice, bob} {
+		if err := s.RemoveFeedFollow(ctx, database.RemoveFeedFollowParams{UserID: user.ID, FeedID: shared.ID}); err != nil {
+			t.Fatalf("RemoveFeedFollow: %v", err)
+		}
+	}
+	followed, err = s.GetFollowedFeedsToFetch(ctx, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetFollowedFeedsToFetch: %v", err)
+	}
+	if got := names(followed); !slices.Equal(got, []string{"alice's", "bob's"}) {
+		t.Errorf("GetFollowedFeedsToFetch after unfollowing = %q, want alice's, bob's", got)
+	}
+}
+
+func testFeedSchedule(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	if feed.FetchInterval.Valid || feed.Ttl.Valid || feed.NextFetchAt.Valid || feed.SkipHours != 0 || feed.SkipDays != 0 {
+		t.Errorf("new feed has a schedule %+v, want none", feed)
+	}
+
+	// The feed's own ttl and skip times are saved with each fetch
+	next := now().Add(time.Hour)
+	marked, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:             feed.ID,
+		UpdatedAt:      now(),
+		LastFetchedAt:  sql.NullTime{Time: now(), Valid: true},
+		NextFetchAt:    sql.NullTime{Time: next, Valid: true},
+		Ttl:            sql.NullInt32{Int32: 60, Valid: true},
+		SkipHours:      1<<0 | 1<<23,
+		SkipDays:       1 << int(time.Sunday),
+		ScheduleReason: sql.NullString{String: "feed ttl", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkFeedFetched: %v", err)
+	}
+	if marked.Ttl.Int32 != 60 || marked.SkipHours != 1<<0|1<<23 || marked.SkipDays != 1 || !marked.NextFetchAt.Time.Equal(next) || marked.ScheduleReason.String != "feed ttl" {
+		t.Errorf("MarkFeedFetched = %+v, want the ttl, skip times and next fetch", marked)
+	}
+
+	// The interval is set by the user and kept by later fetches
+	next = now().Add(6 * time.Hour)
+	set, err := s.SetFeedFetchInterval(ctx, database.SetFeedFetchIntervalParams{
+		ID:             feed.ID,
+		UpdatedAt:      now(),
+		FetchInterval:  sql.NullInt32{Int32: 6 * 60 * 60, Valid: true},
+		NextFetchAt:    sql.NullTime{Time: next, Valid: true},
+		ScheduleReason: sql.NullString{String: "setinterval", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("SetFeedFetchInterval: %v", err)
+	}
+	if set.FetchInterval.Int32 != 6*60*60 || !set.NextFetchAt.Time.Equal(next) || set.Ttl.Int32 != 60 || set.ScheduleReason.String != "setinterval" {
+		t.Errorf("SetFeedFetchInterval = %+v, want a 6h interval", set)
+	}
+
+	failed, err := s.MarkFeedFetchFailed(ctx, database.MarkFeedFetchFailedParams{
+		ID:             feed.ID,
+		UpdatedAt:      now(),
+		LastFetchedAt:  sql.NullTime{Time: now(), Valid: true},
+		LastFetchError: sql.NullString{String: "unexpected status: 500", Valid: true},
+		NextFetchAt:    sql.NullTime{Time: next, Valid: true},
+		ScheduleReason: sql.NullString{String: "failed", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkFeedFetchFailed: %v", err)
+	}
+	if !failed.FetchInterval.Valid || failed.Ttl.Int32 != 60 || failed.SkipDays != 1 || failed.ScheduleReason.String != "failed" {
+		t.Errorf("MarkFeedFetchFailed = %+v, want the schedule kept", failed)
+	}
+
+	// Clearing the interval goes back to the ttl
+	cleared, err := s.SetFeedFetchInterval(ctx, database.SetFeedFetchIntervalParams{
+		ID:          feed.ID,
+		UpdatedAt:   now(),
+		NextFetchAt: sql.NullTime{Time: next, Valid: true},
+	})
+	if err != nil || cleared.FetchInterval.Valid {
+		t.Errorf("SetFeedFetchInterval to NULL = %+v, %v, want no interval", cleared, err)
+	}
+}
+
+func testFeedFetchError(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+
+	failed, err := s.MarkFeedFetchFailed(ctx, database.MarkFeedFetchFailedParams{
+		ID:             feed.ID,
+		UpdatedAt:      now(),
+		LastFetchedAt:  sql.NullTime{Time: now(), Valid: true},
+		LastFetchError: sql.NullString{String: "unexpected status: 500", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkFeedFetchFailed: %v", err)
+	}
+	if failed.LastFetchError.String != "unexpected status: 500" || !failed.LastFetchedAt.Valid {
+		t.Errorf("MarkFeedFetchFailed = %+v, want the error and a fetch time", failed)
+	}
+	got, err := s.GetFeedByUrl(ctx, feed.Url)
+	if err != nil || got.LastFetchError != failed.LastFetchError {
+		t.Errorf("GetFeedByUrl = %+v, %v, want the fetch error", got, err)
+	}
+
+	// A fetch that works clears the error
+	marked, err := s.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:            feed.ID,
+		UpdatedAt:     now(),
+		LastFetchedAt: sql.NullTime{Time: now(), Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkFeedFetched: %v", err)
+	}
+	if marked.LastFetchError.Valid {
+		t.Errorf("MarkFeedFetched left last_fetch_error %q", marked.LastFetchError.String)
+	}
+}
+
+func testRecentPublishTimes(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	other := createFeed(t, s, user, "other")
+
+	base := now().Truncate(time.Hour)
+	upsert(t, s, feed, now(),
+		testPost{guid: "1", title: "old", publishedAt: base.Add(-3 * time.Hour), hash: "1"},
+		testPost{guid: "2", title: "newer", publishedAt: base.Add(-time.Hour), hash: "2"},
+		testPost{guid: "3", title: "newest", publishedAt: base.Add(-2 * time.Hour), hash: "3"},
+		testPost{guid: "4", title: "no date", hash: "4"},
+		testPost{guid: "5", title: "future", publishedAt: base.Add(time.Hour), hash: "5"},
+	)
+	upsert(t, s, other, now(), testPost{guid: "1", title: "other", publishedAt: base, hash: "1"})
+
+	// Newest first, without posts that have no date or a date after now and
+	// only up to max_posts
+	got, err := s.GetRecentPublishTimes(ctx, database.GetRecentPublishTimesParams{
+		FeedID:   feed.ID,
+		Now:      base,
+		MaxPosts: 2,
+	})
+	if err != nil {
+		t.Fatalf("GetRecentPublishTimes: %v", err)
+	}
+	want := []time.Time{base.Add(-time.Hour), base.Add(-2 * time.Hour)}
+	if len(got) != len(want) {
+		t.Fatalf("GetRecentPublishTimes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i].Valid || !got[i].Time.Equal(want[i]) {
+			t.Errorf("GetRecentPublishTimes[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func testFeedFetches(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	other := createFeed(t, s, user, "other")
+
+	start := now()
+	fetches := []database.CreateFeedFetchParams{
+		{ID: uuid.New(), FeedID: feed.ID, StartedAt: start.Add(-2 * time.Hour), DurationMs: 120, HttpStatus: sql.NullInt32{Int32: 200, Valid: true}, Bytes: 5120, ItemsParsed: 10, PostsInserted: 10},
+		{ID: uuid.New(), FeedID: feed.ID, StartedAt: start.Add(-time.Hour), DurationMs: 20000, Error: sql.NullString{String: "timeout", Valid: true}},
+		{ID: uuid.New(), FeedID: feed.ID, StartedAt: start, DurationMs: 80, HttpStatus: sql.NullInt32{Int32: 500, Valid: true}, Bytes: 12, Error: sql.NullString{String: "unexpected status", Valid: true}},
+		{ID: uuid.New(), FeedID: other.ID, StartedAt: start, DurationMs: 10, HttpStatus: sql.NullInt32{Int32: 200, Valid: true}},
+	}
+	for _, f := range fetches {
+		if err := s.CreateFeedFetch(ctx, f); err != nil {
+			t.Fatalf("CreateFeedFetch: %v", err)
+		}
+	}
+	if err := s.CreateFeedFetch(ctx, database.CreateFeedFetchParams{ID: uuid.New(), FeedID: uuid.New(), StartedAt: start}); err == nil {
+		t.Errorf("CreateFeedFetch for a missing feed worked, want an error")
+	}
+
+	// Newest first, only the feed's own fetches and up to the limit
+	got, err := s.GetFeedFetches(ctx, database.GetFeedFetchesParams{FeedID: feed.ID, Limit: 2})
+	if err != nil {
+		t.Fatalf("GetFeedFetches: %v", err)
+	}
+	want := []database.FeedFetch{database.FeedFetch(fetches[2]), database.FeedFetch(fetches[1])}
+	if len(got) != len(want) {
+		t.Fatalf("GetFeedFetches = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].StartedAt.Equal(want[i].StartedAt) {
+			t.Errorf("fetch %d started at %v, want %v", i, got[i].StartedAt, want[i].StartedAt)
+		}
+		got[i].StartedAt = want[i].StartedAt
+		if got[i] != want[i] {
+			t.Errorf("fetch %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Everything older than an hour ago goes, for every feed
+	deleted, err := s.DeleteFeedFetchesBefore(ctx, start.Add(-time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteFeedFetchesBefore = %d, %v, want 1", deleted, err)
+	}
+	got, err = s.GetFeedFetches(ctx, database.GetFeedFetchesParams{FeedID: feed.ID, Limit: 10})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("GetFeedFetches after deleting = %d fetches, %v, want 2", len(got), err)
+	}
+}
+
+func testFeedFollows(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	feed := createFeed(t, s, alice, "blog")
+
+	row := follow(t, s, bob, feed)
+	if row.FeedName != "blog" || row.UserName != "bob" {
+		t.Errorf("CreateFeedFollow = %+v, want feed blog and user bob", row)
+	}
+
+	_, err := s.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UpdatedAt: now(),
+		UserID:    bob.ID,
+		FeedID:    feed.ID,
+	})
+	if !database.IsUniqueViolation(err) {
+		t.Errorf("CreateFeedFollow twice: got %v, want a unique violation", err)
+	}
+
+	follows, err := s.GetFeedFollowsForUser(ctx, bob.ID)
+	if err != nil || len(follows) != 1 || follows[0].FeedName != "blog" {
+		t.Errorf("GetFeedFollowsForUser = %+v, %v, want one follow of blog", follows, err)
+	}
+
+	err = s.RemoveFeedFollow(ctx, database.RemoveFeedFollowParams{UserID: bob.ID, FeedID: feed.ID})
+	if err != nil {
+		t.Fatalf("RemoveFeedFollow: %v", err)
+	}
+	follows, err = s.GetFeedFollowsForUser(ctx, bob.ID)
+	if err != nil || len(follows) != 0 {
+		t.Errorf("GetFeedFollowsForUser after unfollow = %+v, %v, want none", follows, err)
+	}
+}
+
+func testUpsertPosts(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	published := now().Add(-time.Hour)
+
+	rows := upsert(t, s, feed, now(),
+		testPost{guid: "a", title: "A", description: "first", publishedAt: published, hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	if len(rows) != 2 || !rows[0].Inserted || !rows[1].Inserted {
+		t.Fatalf("first UpsertPosts = %+v, want 2 inserted rows", rows)
+	}
+	postA := rows[0].ID
+	if rows[0].Guid != "a" {
+		postA = rows[1].ID
+	}
+
+	// Empty strings and the zero time are stored as NULL
+	post, err := s.GetPost(ctx, postA)
+	if err != nil {
+		t.Fatalf("GetPost: %v", err)
+	}
+	if post.FeedName != "blog" || post.Description.String != "first" || !post.PublishedAt.Time.Equal(published) {
+		t.Errorf("GetPost = %+v, want feed blog, description first, published %v", post, published)
+	}
+	if post.Content.Valid || post.Author.Valid {
+		t.Errorf("GetPost content %v author %v, want NULL", post.Content, post.Author)
+	}
+	for _, row := range rows {
+		if row.Guid == "b" {
+			post, err := s.GetPost(ctx, row.ID)
+			if err != nil {
+				t.Fatalf("GetPost: %v", err)
+			}
+			if post.Description.Valid || post.PublishedAt.Valid {
+				t.Errorf("post b has description %v published %v, want NULL", post.Description, post.PublishedAt)
+			}
+		}
+	}
+
+	// Unchanged posts return no rows and make no revisions
+	rows = upsert(t, s, feed, now(),
+		testPost{guid: "a", title: "A", description: "first", publishedAt: published, hash: "a1"},
+	)
+	if len(rows) != 0 {
+		t.Errorf("UpsertPosts of an unchanged post = %+v, want no rows", rows)
+	}
+
+	// Edited posts are updated and the old version is kept
+	rows = upsert(t, s, feed, now(),
+		testPost{guid: "a", title: "A edited", description: "second", publishedAt: published, hash: "a2"},
+	)
+	if len(rows) != 1 || rows[0].Inserted || rows[0].ID != postA {
+		t.Fatalf("UpsertPosts of an edited post = %+v, want one updated row for %s", rows, postA)
+	}
+	post, err = s.GetPost(ctx, postA)
+	if err != nil || post.Title != "A edited" || post.ContentHash != "a2" {
+		t.Errorf("GetPost after edit = %+v, %v, want title A edited and hash a2", post, err)
+	}
+	revisions, err := s.GetPostRevisions(ctx, postA)
+	if err != nil {
+		t.Fatalf("GetPostRevisions: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Title != "A" || revisions[0].ContentHash != "a1" {
+		t.Errorf("GetPostRevisions = %+v, want the A a1 version", revisions)
+	}
+
+	// Posts saved before content hashes existed are updated without a
+	// revision
+	rows = upsert(t, s, feed, now(), testPost{guid: "c", title: "C", hash: ""})
+	if len(rows) != 1 {
+		t.Fatalf("UpsertPosts of post c = %+v, want one row", rows)
+	}
+	postC := rows[0].ID
+	rows = upsert(t, s, feed, now(), testPost{guid: "c", title: "C", hash: "c1"})
+	if len(rows) != 1 || rows[0].Inserted {
+		t.Errorf("UpsertPosts of post c with a hash = %+v, want one updated row", rows)
+	}
+	revisions, err = s.GetPostRevisions(ctx, postC)
+	if err != nil || len(revisions) != 0 {
+		t.Errorf("GetPostRevisions of post c = %+v, %v, want none", revisions, err)
+	}
+
+	// The same guid in another feed is another post
+	other := createFeed(t, s, user, "other")
+	rows = upsert(t, s, other, now(), testPost{guid: "a", title: "A", hash: "a1"})
+	if len(rows) != 1 || !rows[0].Inserted || rows[0].ID == postA {
+		t.Errorf("UpsertPosts of guid a in another feed = %+v, want a new post", rows)
+	}
+}
+
+func testLegacyPostGuids(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	other := createFeed(t, s, user, "other")
+
+	// Posts the way migration 007 left them, with their raw url as guid
+	const (
+		rawA = "HTTPS://Example.com/a?utm_source=rss"
+		rawB = "https://example.com/b"
+		rawC = "https://example.com/c#top"
+	)
+	legacyA := upsert(t, s, feed, now(), testPost{guid: rawA, url: rawA, title: "A", hash: "a1"})[0].ID
+	postB := upsert(t, s, feed, now(), testPost{guid: rawB, url: rawB, title: "B", hash: "b1"})[0].ID
+	legacyC := upsert(t, s, feed, now(), testPost{guid: rawC, url: rawC, title: "C", hash: "c1"})[0].ID
+	otherA := upsert(t, s, other, now(), testPost{guid: rawA, url: rawA, title: "A", hash: "a1"})[0].ID
+	// C was already saved again under its new guid
+	upsert(t, s, feed, now(), testPost{guid: "https://example.com/c", url: rawC, title: "C", hash: "c1"})
+
+	arg := database.UpdateLegacyPostGuidsParams{
+		Urls:   []string{rawA, rawB, rawC, "https://example.com/new"},
+		Guids:  []string{"https://example.com/a", rawB, "https://example.com/c", "https://example.com/new"},
+		FeedID: feed.ID,
+	}
+	moved, err := s.UpdateLegacyPostGuids(ctx, arg)
+	if err != nil {
+		t.Fatalf("UpdateLegacyPostGuids: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("UpdateLegacyPostGuids moved %d posts, want 1", moved)
+	}
+
+	wantGuids := map[uuid.UUID]string{
+		legacyA: "https://example.com/a",
+		postB:   rawB,
+		legacyC: rawC,
+		otherA:  rawA,
+	}
+	for id, want := range wantGuids {
+		post, err := s.GetPost(ctx, id)
+		if err != nil {
+			t.Fatalf("GetPost: %v", err)
+		}
+		if post.Guid != want {
+			t.Errorf("post %s has guid %q, want %q", post.Title, post.Guid, want)
+		}
+	}
+
+	// The moved post is found by its new guid and nothing is left to move
+	rows := upsert(t, s, feed, now(), testPost{guid: "https://example.com/a", url: rawA, title: "A", hash: "a1"})
+	if len(rows) != 0 {
+		t.Errorf("UpsertPosts of the moved post = %+v, want no rows", rows)
+	}
+	moved, err = s.UpdateLegacyPostGuids(ctx, arg)
+	if err != nil || moved != 0 {
+		t.Errorf("second UpdateLegacyPostGuids = %d, %v, want 0", moved, err)
+	}
+}
+
+func testPostsForUser(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	followed := createFeed(t, s, bob, "followed")
+	notFollowed := createFeed(t, s, bob, "not followed")
+	follow(t, s, alice, followed)
+
+	base := now().Add(-24 * time.Hour)
+	upsert(t, s, followed, now(),
+		testPost{guid: "old", title: "old", publishedAt: base, hash: "1"},
+		testPost{guid: "new", title: "new", publishedAt: base.Add(time.Hour), hash: "2"},
+		testPost{guid: "undated", title: "undated", hash: "3"},
+	)
+	upsert(t, s, notFollowed, now(), testPost{guid: "other", title: "other", publishedAt: base, hash: "4"})
+
+	// Newest first, posts with no date sort first like Postgres DESC
+	posts, err := s.GetPostsForUser(ctx, database.GetPostsForUserParams{UserID: alice.ID, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetPostsForUser: %v", err)
+	}
+	var titles []string
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+		if post.FeedName != "followed" {
+			t.Errorf("post %s is from feed %s, want followed", post.Title, post.FeedName)
+		}
+	}
+	want := []string{"undated", "new", "old"}
+	if len(titles) != len(want) || titles[0] != want[0] || titles[1] != want[1] || titles[2] != want[2] {
+		t.Errorf("GetPostsForUser titles = %v, want %v", titles, want)
+	}
+
+	posts, err = s.GetPostsForUser(ctx, database.GetPostsForUserParams{UserID: alice.ID, Limit: 2})
+	if err != nil || len(posts) != 2 {
+		t.Errorf("GetPostsForUser with limit 2 = %d posts, %v", len(posts), err)
+	}
+}
+
+func testPostExtras(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	rows := upsert(t, s, feed, now(), testPost{guid: "a", title: "A", hash: "a1"})
+	postID := rows[0].ID
+
+	// Duplicates are ignored
+	for i := 0; i < 2; i++ {
+		err := s.CreatePostCategories(ctx, database.CreatePostCategoriesParams{
+			Now:     now(),
+			PostIds: []uuid.UUID{postID, postID},
+			Names:   []string{"go", "db"},
+		})
+		if err != nil {
+			t.Fatalf("CreatePostCategories: %v", err)
+		}
+		err = s.CreatePostEnclosures(ctx, database.CreatePostEnclosuresParams{
+			Now:       now(),
+			PostIds:   []uuid.UUID{postID, postID},
+			Urls:      []string{"https://example.com/b.mp3", "https://example.com/a.mp3"},
+			Lengths:   []int64{0, 1234},
+			MimeTypes: []string{"", "audio/mpeg"},
+		})
+		if err != nil {
+			t.Fatalf("CreatePostEnclosures: %v", err)
+		}
+	}
+
+	categories, err := s.GetPostCategories(ctx, postID)
+	if err != nil {
+		t.Fatalf("GetPostCategories: %v", err)
+	}
+	if len(categories) != 2 || categories[0] != "db" || categories[1] != "go" {
+		t.Errorf("GetPostCategories = %v, want [db go]", categories)
+	}
+
+	enclosures, err := s.GetPostEnclosures(ctx, postID)
+	if err != nil {
+		t.Fatalf("GetPostEnclosures: %v", err)
+	}
+	if len(enclosures) != 2 {
+		t.Fatalf("GetPostEnclosures = %+v, want 2", enclosures)
+	}
+	if enclosures[0].Length.Int64 != 1234 || enclosures[0].MimeType.String != "audio/mpeg" {
+		t.Errorf("first enclosure = %+v, want a.mp3 with length and type", enclosures[0])
+	}
+	if enclosures[1].Length.Valid || enclosures[1].MimeType.Valid {
+		t.Errorf("second enclosure = %+v, want NULL length and type", enclosures[1])
+	}
+}
+
+func testPrunePosts(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	other := createFeed(t, s, user, "other")
+
+	// Newest first d, c, b by when it was stored and a
+	start := now()
+	upsert(t, s, feed, start.Add(-72*time.Hour),
+		testPost{guid: "a", title: "A", publishedAt: start.Add(-96 * time.Hour), hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	rows := upsert(t, s, feed, start.Add(-24*time.Hour),
+		testPost{guid: "c", title: "C", publishedAt: start.Add(-24 * time.Hour), hash: "c1"},
+		testPost{guid: "d", title: "D", publishedAt: start.Add(-2 * time.Hour), hash: "d1"},
+	)
+	upsert(t, s, other, start.Add(-72*time.Hour), testPost{guid: "e", title: "E", hash: "e1"})
+	postC := rows[0].ID
+	if rows[0].Guid != "c" {
+		postC = rows[1].ID
+	}
+	err := s.CreatePostCategories(ctx, database.CreatePostCategoriesParams{Now: start, PostIds: []uuid.UUID{postC}, Names: []string{"go"}})
+	if err != nil {
+		t.Fatalf("CreatePostCategories: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		storedBefore time.Time
+		keepPosts    int32
+		want         int64
+	}{
+		{name: "nothing", want: 0},
+		{name: "stored before", storedBefore: start.Add(-48 * time.Hour), want: 2},
+		{name: "newest kept", keepPosts: 3, want: 1},
+		{name: "either", storedBefore: start.Add(-48 * time.Hour), keepPosts: 1, want: 3},
+	}
+	for _, tt := range tests {
+		got, err := s.CountPostsToPrune(ctx, database.CountPostsToPruneParams{FeedID: feed.ID, StoredBefore: tt.storedBefore, KeepPosts: tt.keepPosts})
+		if err != nil || got != tt.want {
+			t.Errorf("CountPostsToPrune %s = %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+
+	// Deleted in batches until nothing is left to prune
+	arg := database.DeletePostsToPruneParams{FeedID: feed.ID, StoredBefore: start.Add(-48 * time.Hour), KeepPosts: 1, BatchSize: 2}
+	for _, want := range []int64{2, 1, 0} {
+		deleted, err := s.DeletePostsToPrune(ctx, arg)
+		if err != nil || deleted != want {
+			t.Fatalf("DeletePostsToPrune = %d, %v, want %d", deleted, err, want)
+		}
+	}
+	for _, f := range []database.Feed{feed, other} {
+		left, err := s.CountPostsToPrune(ctx, database.CountPostsToPruneParams{FeedID: f.ID, StoredBefore: start})
+		if err != nil || left != 1 {
+			t.Errorf("%s has %d posts left, %v, want 1", f.Name, left, err)
+		}
+	}
+	categories, err := s.GetPostCategories(ctx, postC)
+	if err != nil || len(categories) != 0 {
+		t.Errorf("GetPostCategories of a pruned post = %v, %v, want none", categories, err)
+	}
+
+	// The policy of a feed is stored on it, NULL uses the global settings
+	got, err := s.SetFeedRetention(ctx, database.SetFeedRetentionParams{
+		ID:            feed.ID,
+		UpdatedAt:     start,
+		RetentionDays: sql.NullInt32{Int32: 30, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("SetFeedRetention: %v", err)
+	}
+	if got.RetentionDays != (sql.NullInt32{Int32: 30, Valid: true}) || got.RetentionPosts.Valid {
+		t.Errorf("SetFeedRetention = %v days and %v posts, want 30 days and NULL", got.RetentionDays, got.RetentionPosts)
+	}
+	stored, err := s.GetFeedByUrl(ctx, feed.Url)
+	if err != nil || stored.RetentionDays != got.RetentionDays || stored.RetentionPosts.Valid {
+		t.Errorf("GetFeedByUrl after SetFeedRetention = %+v, %v", stored, err)
+	}
+}
+
+func testPostStars(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	feed := createFeed(t, s, alice, "blog")
+	start := now()
+	rows := upsert(t, s, feed, start.Add(-72*time.Hour),
+		testPost{guid: "a", title: "A", hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	postA := rows[0].ID
+
+	star := func(user database.User, postID uuid.UUID) error {
+		return s.StarPost(ctx, database.StarPostParams{ID: uuid.New(), CreatedAt: start, UserID: user.ID, PostID: postID})
+	}
+	starred := func(user database.User) bool {
+		t.Helper()
+		got, err := s.IsPostStarred(ctx, database.IsPostStarredParams{UserID: user.ID, PostID: postA})
+		if err != nil {
+			t.Fatalf("IsPostStarred: %v", err)
+		}
+		return got
+	}
+
+	// Starring twice keeps one star, stars are per user
+	for range 2 {
+		if err := star(alice, postA); err != nil {
+			t.Fatalf("StarPost: %v", err)
+		}
+	}
+	if !starred(alice) || starred(bob) {
+		t.Errorf("IsPostStarred = %v for alice and %v for bob, want only alice", starred(alice), starred(bob))
+	}
+	if err := star(alice, uuid.New()); err == nil {
+		t.Errorf("StarPost of a missing post worked, want an error")
+	}
+
+	// Starred posts are never pruned
+	prune := database.CountPostsToPruneParams{FeedID: feed.ID, StoredBefore: start}
+	if got, err := s.CountPostsToPrune(ctx, prune); err != nil || got != 1 {
+		t.Errorf("CountPostsToPrune with a starred post = %d, %v, want 1", got, err)
+	}
+	deleted, err := s.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{FeedID: feed.ID, StoredBefore: start, BatchSize: 10})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeletePostsToPrune with a starred post = %d, %v, want 1", deleted, err)
+	}
+	if _, err := s.GetPost(ctx, postA); err != nil {
+		t.Errorf("GetPost of the starred post after pruning: %v", err)
+	}
+
+	// Once nobody stars it, it is pruned
+	removed, err := s.UnstarPost(ctx, database.UnstarPostParams{UserID: bob.ID, PostID: postA})
+	if err != nil || removed != 0 {
+		t.Errorf("UnstarPost of a post bob didn't star = %d, %v, want 0", removed, err)
+	}
+	removed, err = s.UnstarPost(ctx, database.UnstarPostParams{UserID: alice.ID, PostID: postA})
+	if err != nil || removed != 1 {
+		t.Errorf("UnstarPost = %d, %v, want 1", removed, err)
+	}
+	if starred(alice) {
+		t.Errorf("IsPostStarred after UnstarPost = true")
+	}
+	if got, err := s.CountPostsToPrune(ctx, prune); err != nil || got != 1 {
+		t.Errorf("CountPostsToPrune after UnstarPost = %d, %v, want 1", got, err)
+	}
+}
+
+func testPostReads(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	feed := createFeed(t, s, alice, "blog")
+	unfollowed := createFeed(t, s, alice, "unfollowed")
+	follow(t, s, alice, feed)
+	follow(t, s, bob, feed)
+	start := now()
+	rows := upsert(t, s, feed, start.Add(-72*time.Hour),
+		testPost{guid: "a", title: "A", hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	postA, postB := rows[0].ID, rows[1].ID
+	upsert(t, s, unfollowed, start.Add(-72*time.Hour), testPost{guid: "c", title: "C", hash: "c1"})
+
+	read := func(user database.User, postID uuid.UUID) error {
+		return s.MarkPostRead(ctx, database.MarkPostReadParams{ID: uuid.New(), CreatedAt: start, UserID: user.ID, PostID: postID})
+	}
+	prune := database.CountPostsToPruneParams{FeedID: feed.ID, StoredBefore: start}
+
+	// A post is kept until everyone following its feed has read it, reading
+	// twice keeps one read
+	for range 2 {
+		if err := read(alice, postA); err != nil {
+			t.Fatalf("MarkPostRead: %v", err)
+		}
+	}
+	if err := read(alice, postB); err != nil {
+		t.Fatalf("MarkPostRead: %v", err)
+	}
+	if got, err := s.CountPostsToPrune(ctx, prune); err != nil || got != 0 {
+		t.Errorf("CountPostsToPrune with posts bob hasn't read = %d, %v, want 0", got, err)
+	}
+	if err := read(bob, postA); err != nil {
+		t.Fatalf("MarkPostRead: %v", err)
+	}
+	if got, err := s.CountPostsToPrune(ctx, prune); err != nil || got != 1 {
+		t.Errorf("CountPostsToPrune with A read by everyone = %d, %v, want 1", got, err)
+	}
+	if err := read(alice, uuid.New()); err == nil {
+		t.Errorf("MarkPostRead of a missing post worked, want an error")
+	}
+
+	// The posts of a feed nobody follows have nobody to read them
+	got, err := s.CountPostsToPrune(ctx, database.CountPostsToPruneParams{FeedID: unfollowed.ID, StoredBefore: start})
+	if err != nil || got != 1 {
+		t.Errorf("CountPostsToPrune of a feed nobody follows = %d, %v, want 1", got, err)
+	}
+
+	// A post marked unread is kept again
+	removed, err := s.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: bob.ID, PostID: postA})
+	if err != nil || removed != 1 {
+		t.Errorf("MarkPostUnread = %d, %v, want 1", removed, err)
+	}
+	removed, err = s.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: bob.ID, PostID: postA})
+	if err != nil || removed != 0 {
+		t.Errorf("MarkPostUnread of a post bob hasn't read = %d, %v, want 0", removed, err)
+	}
+	deleted, err := s.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{FeedID: feed.ID, StoredBefore: start, BatchSize: 10})
+	if err != nil || deleted != 0 {
+		t.Errorf("DeletePostsToPrune with posts bob hasn't read = %d, %v, want 0", deleted, err)
+	}
+
+	// Pruning a read post deletes its reads
+	if err := read(bob, postA); err != nil {
+		t.Fatalf("MarkPostRead: %v", err)
+	}
+	deleted, err = s.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{FeedID: feed.ID, StoredBefore: start, BatchSize: 10})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeletePostsToPrune with A read by everyone = %d, %v, want 1", deleted, err)
+	}
+	removed, err = s.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: alice.ID, PostID: postA})
+	if err != nil || removed != 0 {
+		t.Errorf("MarkPostUnread of a pruned post = %d, %v, want 0", removed, err)
+	}
+	if _, err := s.GetPost(ctx, postB); err != nil {
+		t.Errorf("GetPost of the post bob hasn't read after pruning: %v", err)
+	}
+}
+
+func testPrunedPosts(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	other := createFeed(t, s, user, "other")
+	start := now()
+	upsert(t, s, feed, start.Add(-72*time.Hour),
+		testPost{guid: "a", title: "A", hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	upsert(t, s, other, start.Add(-72*time.Hour), testPost{guid: "a", title: "A", hash: "a1"})
+
+	deleted, err := s.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{
+		FeedID:       feed.ID,
+		StoredBefore: start,
+		BatchSize:    10,
+		Now:          start,
+	})
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeletePostsToPrune = %d, %v, want 2", deleted, err)
+	}
+
+	// Pruned posts aren't saved again, even when edited, new posts and the
+	// same guid in another feed are
+	rows := upsert(t, s, feed, start,
+		testPost{guid: "a", title: "A", hash: "a1"},
+		testPost{guid: "b", title: "B edited", hash: "b2"},
+		testPost{guid: "c", title: "C", hash: "c1"},
+	)
+	if len(rows) != 1 || rows[0].Guid != "c" || !rows[0].Inserted {
+		t.Errorf("UpsertPosts of pruned posts = %+v, want only c inserted", rows)
+	}
+	rows = upsert(t, s, other, start, testPost{guid: "a", title: "A edited", hash: "a2"})
+	if len(rows) != 1 || rows[0].Inserted {
+		t.Errorf("UpsertPosts of guid a in another feed = %+v, want it updated", rows)
+	}
+
+	// A pruned post is forgotten once its feed stops listing it, and can
+	// then be saved again
+	forgot, err := s.ForgetPrunedPosts(ctx, database.ForgetPrunedPostsParams{FeedID: feed.ID, Guids: []string{"a", "c"}})
+	if err != nil || forgot != 1 {
+		t.Errorf("ForgetPrunedPosts = %d, %v, want 1", forgot, err)
+	}
+	rows = upsert(t, s, feed, start,
+		testPost{guid: "a", title: "A", hash: "a1"},
+		testPost{guid: "b", title: "B", hash: "b1"},
+	)
+	if len(rows) != 1 || rows[0].Guid != "b" || !rows[0].Inserted {
+		t.Errorf("UpsertPosts after ForgetPrunedPosts = %+v, want only b inserted", rows)
+	}
+	forgot, err = s.ForgetPrunedPosts(ctx, database.ForgetPrunedPostsParams{FeedID: other.ID, Guids: []string{"a"}})
+	if err != nil || forgot != 0 {
+		t.Errorf("ForgetPrunedPosts of a feed with nothing pruned = %d, %v, want 0", forgot, err)
+	}
+
+	// A post saved again under a guid that is still pruned, here by moving a
+	// legacy post to it, is only deleted when it is in a batch itself
+	const rawA = "https://example.com/a?utm_source=rss"
+	movedA := upsert(t, s, feed, start, testPost{guid: rawA, url: rawA, title: "A", hash: "a1"})[0].ID
+	moved, err := s.UpdateLegacyPostGuids(ctx, database.UpdateLegacyPostGuidsParams{
+		Urls:   []string{rawA},
+		Guids:  []string{"a"},
+		FeedID: feed.ID,
+	})
+	if err != nil || moved != 1 {
+		t.Fatalf("UpdateLegacyPostGuids = %d, %v, want 1", moved, err)
+	}
+	upsert(t, s, feed, start.Add(-72*time.Hour), testPost{guid: "d", title: "D", hash: "d1"})
+
+	deleted, err = s.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{
+		FeedID:       feed.ID,
+		StoredBefore: start,
+		BatchSize:    10,
+		Now:          start,
+	})
+	if err != nil || deleted != 1 {
+		t.Errorf("DeletePostsToPrune with only d old enough = %d, %v, want 1", deleted, err)
+	}
+	if _, err := s.GetPost(ctx, movedA); err != nil {
+		t.Errorf("GetPost of the post moved to a pruned guid: %v, want it kept", err)
+	}
+}
+
+func testExecTxRollback(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+
+	errFail := errors.New("fail")
+	err := s.ExecTx(ctx, func(q database.Querier) error {
+		upsert(t, q, feed, now(), testPost{guid: "a", title: "A", hash: "a1"})
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("ExecTx = %v, want the error from fn", err)
+	}
+
+	err = s.ExecTx(ctx, func(q database.Querier) error {
+		rows := upsert(t, q, feed, now(), testPost{guid: "b", title: "B", hash: "b1"})
+		if len(rows) != 1 {
+			t.Errorf("UpsertPosts in a transaction = %+v, want one row", rows)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExecTx: %v", err)
+	}
+
+	follow(t, s, user, feed)
+	posts, err := s.GetPostsForUser(ctx, database.GetPostsForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetPostsForUser: %v", err)
+	}
+	if len(posts) != 1 || posts[0].Title != "B" {
+		t.Errorf("posts after a rollback and a commit = %+v, want only B", posts)
+	}
+}
+
+func testClearUsers(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "alice")
+	feed := createFeed(t, s, user, "blog")
+	follow(t, s, user, feed)
+	upsert(t, s, feed, now(), testPost{guid: "a", title: "A", hash: "a1"})
+
+	if err := s.ClearUsers(ctx); err != nil {
+		t.Fatalf("ClearUsers: %v", err)
+	}
+
+	// Deleting the users cascades to everything else
+	users, err := s.GetUsers(ctx)
+	if err != nil || len(users) != 0 {
+		t.Errorf("GetUsers after ClearUsers = %+v, %v, want none", users, err)
+	}
+	feeds, err := s.GetFeeds(ctx)
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("GetFeeds after ClearUsers = %+v, %v, want none", feeds, err)
+	}
+}
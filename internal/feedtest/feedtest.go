@@ -0,0 +1,298 @@
+// Package feedtest is a local feed server for end to end tests, each path
+// serves a Response that can be swapped out between fetches to make a feed
+// change, break or misbehave
+package feedtest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"embed"
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//go:embed testdata
+var fixtures embed.FS
+
+// Response is what the server sends for a path
+type Response struct {
+	Status      int
+	ContentType string
+	Body        string
+	// Headers are extra response headers
+	Headers map[string]string
+	// Delay is how long to wait before responding, the wait ends early if
+	// the client gives up
+	Delay time.Duration
+	// Padding is the number of filler bytes streamed after Body, to make
+	// huge responses without holding them in memory
+	Padding int64
+	// Trailer is written after the Padding
+	Trailer string
+}
+
+// Server serves the feeds over HTTP on a local port
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	responses   map[string]Response
+	requests    map[string]int
+	headers     map[string]http.Header
+	connections int
+}
+
+// NewServer starts a server that is closed when the test ends, unknown
+// paths get a 404
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		responses: make(map[string]Response),
+		requests:  make(map[string]int),
+		headers:   make(map[string]http.Header),
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Set makes path serve resp from now on
+func (s *Server) Set(path string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = resp
+}
+
+// FeedURL returns the full URL of a path on the server
+func (s *Server) FeedURL(path string) string {
+	return s.URL + path
+}
+
+// Requests returns how many times path was requested
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Header returns the headers of the last request for path
+func (s *Server) Header(path string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[path]
+}
+
+// Connections returns how many connections clients have opened
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	resp, ok := s.responses[r.URL.Path]
+	s.requests[r.URL.Path]++
+	s.headers[r.URL.Path] = r.Header.Clone()
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+
+	io.WriteString(w, resp.Body)
+	if resp.Padding > 0 {
+		io.CopyN(w, filler{}, resp.Padding)
+	}
+	io.WriteString(w, resp.Trailer)
+}
+
+// filler is an endless reader of 'x' bytes
+type filler struct{}
+
+func (filler) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+// Item is one post in a feed built by RSS
+type Item struct {
+	Title       string
+	Link        string
+	GUID        string
+	Description string
+	PubDate     time.Time
+}
+
+// RSS returns an RSS 2.0 feed with the items
+func RSS(title string, items ...Item) Response {
+	return Response{
+		ContentType: "application/rss+xml; charset=utf-8",
+		Body:        rssDocument(title, items),
+	}
+}
+
+func rssDocument(title string, items []Item) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<rss version="2.0"><channel>` + "\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(title))
+	for _, item := range items {
+		b.WriteString("<item>")
+		fmt.Fprintf(&b, "<title>%s</title>", html.EscapeString(item.Title))
+		if item.Link != "" {
+			fmt.Fprintf(&b, "<link>%s</link>", html.EscapeString(item.Link))
+		}
+		if item.GUID != "" {
+			fmt.Fprintf(&b, "<guid>%s</guid>", html.EscapeString(item.GUID))
+		}
+		if item.Description != "" {
+			fmt.Fprintf(&b, "<description>%s</description>", html.EscapeString(item.Description))
+		}
+		if !item.PubDate.IsZero() {
+			fmt.Fprintf(&b, "<pubDate>%s</pubDate>", item.PubDate.Format(time.RFC1123Z))
+		}
+		b.WriteString("</item>\n")
+	}
+	b.WriteString("</channel></rss>\n")
+	return b.String()
+}
+
+// WithChannel adds raw elements like <ttl>60</ttl> to the channel of an RSS
+// response
+func WithChannel(elements string, resp Response) Response {
+	resp.Body = strings.Replace(resp.Body, "<channel>", "<channel>"+elements, 1)
+	return resp
+}
+
+// Fixture returns a response with one of the real world feeds in testdata,
+// the content type is guessed from the extension
+func Fixture(name string) Response {
+	body, err := fixtures.ReadFile("testdata/" + name)
+	if err != nil {
+		panic(fmt.Sprintf("feedtest: no fixture %s: %v", name, err))
+	}
+
+	contentType := "application/xml"
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		contentType = "application/feed+json"
+	case strings.HasSuffix(name, ".atom"):
+		contentType = "application/atom+xml"
+	case strings.HasSuffix(name, ".rss"):
+		contentType = "application/rss+xml"
+	}
+	return Response{ContentType: contentType, Body: string(body)}
+}
+
+// Compressed compresses the Body of resp with a Content-Encoding of gzip,
+// deflate, deflate-raw (deflate without the zlib wrapper, which some
+// servers send) or br
+func Compressed(encoding string, resp Response) Response {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		w = zlib.NewWriter(&b)
+	case "deflate-raw":
+		w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+		encoding = "deflate"
+	case "br":
+		w = brotli.NewWriter(&b)
+	default:
+		panic("feedtest: unknown encoding " + encoding)
+	}
+	io.WriteString(w, resp.Body)
+	w.Close()
+
+	resp.Body = b.String()
+	resp.Headers = maps.Clone(resp.Headers)
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	resp.Headers["Content-Encoding"] = encoding
+	return resp
+}
+
+// Slow delays resp by d
+func Slow(d time.Duration, resp Response) Response {
+	resp.Delay = d
+	return resp
+}
+
+// Robots is a robots.txt with the rules
+func Robots(rules string) Response {
+	return Response{ContentType: "text/plain; charset=utf-8", Body: rules}
+}
+
+// Redirect sends the client to another path on the server
+func Redirect(status int, path string) Response {
+	return Response{Status: status, Headers: map[string]string{"Location": path}}
+}
+
+// Status is an error status with a short body
+func Status(status int) Response {
+	return Response{Status: status, ContentType: "text/plain", Body: http.StatusText(status)}
+}
+
+// Malformed is XML that is cut off in the middle of an item
+func Malformed() Response {
+	return Response{
+		ContentType: "application/rss+xml",
+		Body:        `<?xml version="1.0"?><rss version="2.0"><channel><title>Broken</title><item><title>Cut off`,
+	}
+}
+
+// Huge is a valid RSS feed with one item whose description is size bytes
+func Huge(size int64) Response {
+	return Response{
+		ContentType: "application/rss+xml",
+		Body:        `<?xml version="1.0"?><rss version="2.0"><channel><title>Huge</title><item><title>Huge post</title><guid>huge</guid><description>`,
+		Padding:     size,
+		Trailer:     "</description></item></channel></rss>\n",
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+)
+
+// newLogger returns the logger set up by the log_level and log_format
+// settings, the config has checked both already
+func newLogger(w io.Writer, cfg *config.Config) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.LogLevel))
+	opts := &slog.HandlerOptions{Level: level}
+
+	if cfg.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// fatal logs an error that stops the program and exits. Command errors end
+// with a new line which is left out of the log
+func fatal(msg string, err error, args ...any) {
+	args = append(args, "error", strings.TrimSpace(err.Error()))
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
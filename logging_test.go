@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestNewLogger(t *testing.T) {
+	cfg := config.Default()
+	cfg.LogLevel = "warn"
+	cfg.LogFormat = "json"
+
+	var buf bytes.Buffer
+	logger := newLogger(&buf, &cfg)
+	logger.Info("left out")
+	logger.Warn("kept", "feed", "blog")
+
+	var event map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("log %q isn't one JSON event: %v", buf.String(), err)
+	}
+	if event["msg"] != "kept" || event["level"] != "WARN" || event["feed"] != "blog" {
+		t.Errorf("logged %v, want the warning only", event)
+	}
+
+	cfg.LogFormat = "text"
+	buf.Reset()
+	newLogger(&buf, &cfg).Error("failed", "error", "boom")
+	if got := buf.String(); !strings.Contains(got, "level=ERROR msg=failed error=boom") {
+		t.Errorf("text log %q isn't key=value pairs", got)
+	}
+}
+
+func TestFetchEvent(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+	srv.Set("/broken", feedtest.Status(http.StatusNotFound))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "good", srv.FeedURL("/good"))
+	e.run("addfeed", "broken", srv.FeedURL("/broken"))
+
+	events := captureLogs(t, func() {
+		e.agg(0, 0)
+		e.agg(0, 0)
+	})
+
+	// One event for each fetch with everything about it
+	var fetches []map[string]any
+	for _, event := range events {
+		if event["msg"] == "feed fetch" {
+			fetches = append(fetches, event)
+		}
+	}
+	if len(fetches) != 2 {
+		t.Fatalf("logged %d fetch events, want 2: %v", len(fetches), events)
+	}
+	byURL := make(map[string]map[string]any)
+	for _, event := range fetches {
+		for _, key := range []string{"feed_id", "url", "duration", "status", "new_posts"} {
+			if _, ok := event[key]; !ok {
+				t.Errorf("fetch event %v has no %s", event, key)
+			}
+		}
+		byURL[event["url"].(string)] = event
+	}
+
+	good := byURL[srv.FeedURL("/good")]
+	if good["level"] != "INFO" || good["status"] != "ok" || good["new_posts"] != 2.0 || good["error"] != nil {
+		t.Errorf("fetch event of the good feed %v, want ok with 2 new posts", good)
+	}
+	if _, err := time.Parse(time.RFC3339, good["next_fetch_at"].(string)); err != nil {
+		t.Errorf("fetch event of the good feed has next_fetch_at %v: %v", good["next_fetch_at"], err)
+	}
+	broken := byURL[srv.FeedURL("/broken")]
+	if broken["level"] != "ERROR" || broken["status"] != "error" || !strings.Contains(broken["error"].(string), "404") {
+		t.Errorf("fetch event of the broken feed %v, want an error with the status", broken)
+	}
+}
@@ -1,66 +1,130 @@
 package main
 
 import (
-	"database/sql"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/jcourtney5/blog-aggregator/internal/config"
 	"github.com/jcourtney5/blog-aggregator/internal/database"
-	_ "github.com/lib/pq"
 )
 
 type state struct {
 	cfg *config.Config
-	db  *database.Queries
+	db  database.Store
+	// client is shared by every feed fetch
+	client *http.Client
+	// hosts spaces out the requests to each feed host
+	hosts *hostLimiter
+	// metrics are served by agg --metrics-addr
+	metrics *aggMetrics
+	// status is served by agg --health-addr
+	status *aggStatus
+}
+
+func newState(cfg *config.Config, db database.Store) *state {
+	client := newHTTPClient(cfg)
+	return &state{
+		cfg:     cfg,
+		db:      db,
+		client:  client,
+		hosts:   newHostLimiter(cfg, client),
+		metrics: newAggMetrics(),
+		status:  newAggStatus(),
+	}
+}
+
+// globalFlags are the flags that come before the command
+type globalFlags struct {
+	fs         *flag.FlagSet
+	configPath *string
+	profile    *string
+	user       *string
+	logLevel   *string
+	logFormat  *string
+}
+
+func newGlobalFlags() *globalFlags {
+	fs := flag.NewFlagSet(programName(), flag.ExitOnError)
+	return &globalFlags{
+		fs:         fs,
+		configPath: fs.String("config", "", "path to the config file (default ~/.gatorconfig.json)"),
+		profile:    fs.String("profile", "", "use this profile from the config file instead of the active one"),
+		user:       fs.String("user", "", "run the command as this user instead of current_user_name"),
+		logLevel:   fs.String("log-level", "", "least severe level to log: debug, info, warn or error (default info)"),
+		logFormat:  fs.String("log-format", "", "log as text or json (default text)"),
+	}
+}
+
+// overrides returns the config settings set by the flags
+func (f *globalFlags) overrides() map[string]string {
+	overrides := make(map[string]string)
+	if *f.profile != "" {
+		overrides["profile"] = *f.profile
+	}
+	if *f.user != "" {
+		overrides["current_user_name"] = *f.user
+	}
+	if *f.logLevel != "" {
+		overrides["log_level"] = *f.logLevel
+	}
+	if *f.logFormat != "" {
+		overrides["log_format"] = *f.logFormat
+	}
+	return overrides
+}
+
+// programName is the name the binary was run as
+func programName() string {
+	return filepath.Base(os.Args[0])
 }
 
 func main() {
 
-	// Read the current config file
-	cfg, err := config.ReadConfig()
+	// Parse the global flags, they have to come before the command
+	flags := newGlobalFlags()
+	flags.fs.Parse(os.Args[1:])
+
+	// Load the config from the defaults, config file, env vars and flags
+	cfg, err := config.Load(config.Options{
+		Path:      *flags.configPath,
+		Overrides: flags.overrides(),
+	})
 	if err != nil {
-		log.Fatalf("Error reading config: %v\n", err)
+		fatal("failed to read the config", err)
 	}
 
-	// Connect to our SQL db
-	db, err := sql.Open("postgres", cfg.DbURL)
+	// Log with the level and format from the config from here on
+	slog.SetDefault(newLogger(os.Stderr, &cfg))
+
+	// Connect to our db, Postgres or SQLite depending on the db_url
+	db, err := openStore(cfg.DbURL)
 	if err != nil {
-		log.Fatalf("Error connecting to the db: %v\n", err)
+		fatal("failed to connect to the db", err)
 	}
-	defer db.Close()
-	dbQueries := database.New(db)
 
-	// Init state struct
-	st := &state{
-		cfg: &cfg,
-		db:  dbQueries,
-	}
+	// Init state struct, the shell can switch st.db to the DB of another
+	// profile so that is the one closed
+	st := newState(&cfg, db)
+	defer func() { st.db.Close() }()
 
 	// Init commands struct
 	cmds := commands{
-		handlers: make(map[string]func(*state, command) error),
+		handlers: make(map[string]commandInfo),
 	}
 
 	// Register our commands
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", handlerReset)
-	cmds.register("users", handlerUsers)
-	cmds.register("agg", handlerAgg)
-	cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
-	cmds.register("feeds", handlerFeeds)
-	cmds.register("follow", middlewareLoggedIn(handlerFollow))
-	cmds.register("following", middlewareLoggedIn(handlerListFeedFollows))
-	cmds.register("unfollow", middlewareLoggedIn(handlerRemoveFollow))
-	cmds.register("browse", middlewareLoggedIn(handlerBrowse))
-
-	// Get the command line args (skip first one which is program name)
-	args := os.Args[1:]
+	registerCommands(&cmds)
+
+	// Get the command line args left after the global flags
+	args := flags.fs.Args()
 
 	// Make sure we at least have the command
 	if len(args) == 0 {
-		log.Fatalf("Not enough arguments passed, need at least one for the command\n")
+		fatal("not enough arguments", fmt.Errorf("need at least one for the command, run \"%s help\" to see all the commands", programName()))
 	}
 
 	// Create command struct
@@ -72,6 +136,6 @@ func main() {
 	// Run the command
 	err = cmds.run(st, command)
 	if err != nil {
-		log.Fatal(err)
+		fatal("command failed", err, "command", command.name)
 	}
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+)
+
+// newTestState returns a state backed by an empty in memory store with
+// currentUser logged in, the config is never written to disk
+func newTestState(t *testing.T, currentUser string) *state {
+	t.Helper()
+	cfg := config.Default()
+	cfg.DbURL = "memory"
+	cfg.CurrentUserName = currentUser
+	// Keep fetches to the test servers quick
+	cfg.MinHostDelay = config.Duration(time.Millisecond)
+	return newState(&cfg, memory.New())
+}
+
+func mustCreateUser(t *testing.T, s *state, name string) database.User {
+	t.Helper()
+	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", name, err)
+	}
+	return user
+}
+
+func mustCreateFeed(t *testing.T, s *state, user database.User, name, url string) database.Feed {
+	t.Helper()
+	feed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      name,
+		Url:       url,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeed(%s): %v", name, err)
+	}
+	return feed
+}
+
+func mustFollow(t *testing.T, s *state, user database.User, feed database.Feed) {
+	t.Helper()
+	_, err := s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateFeedFollow: %v", err)
+	}
+}
+
+// captureStdout returns what fn prints, the handlers print straight to
+// stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-out
+}
+
+// captureLogs returns the events logged while fn runs, decoded from JSON
+func captureLogs(t *testing.T, fn func()) []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(logger)
+
+	fn()
+
+	var events []map[string]any
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event map[string]any
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("log isn't JSON: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Fetch outcomes, the outcome label of gator_feed_fetches_total
+const (
+	outcomeOK         = "ok"
+	outcomeTimeout    = "timeout"
+	outcomeTooLarge   = "too_large"
+	outcomeError      = "error"
+	outcomeSaveFailed = "save_failed"
+)
+
+// aggMetrics are the Prometheus metrics of agg. They have their own registry
+// instead of the global one so every state starts from zero
+type aggMetrics struct {
+	registry *prometheus.Registry
+
+	fetches          *prometheus.CounterVec
+	fetchDuration    prometheus.Histogram
+	posts            *prometheus.CounterVec
+	feedsOverdue     prometheus.Gauge
+	lastSuccessCycle prometheus.Gauge
+}
+
+func newAggMetrics() *aggMetrics {
+	m := &aggMetrics{
+		registry: prometheus.NewRegistry(),
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gator_feed_fetches_total",
+			Help: "Feed fetches by outcome: ok, timeout, too_large, error or save_failed.",
+		}, []string{"outcome"}),
+		fetchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "gator_feed_fetch_duration_seconds",
+			Help: "How long fetching and parsing a feed took, not counting the wait for its host.",
+			// http_timeout is 20s by default
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30},
+		}),
+		posts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gator_posts_total",
+			Help: "Posts in the fetched feeds by what happened to them: inserted, updated or duplicate.",
+		}, []string{"result"}),
+		feedsOverdue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gator_feeds_overdue",
+			Help: "Feeds that were due but not fetched yet after the last cycle.",
+		}),
+		lastSuccessCycle: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "gator_last_successful_cycle_timestamp_seconds",
+			Help: "Unix time of the last agg cycle that had no failed fetches.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.fetches,
+		m.fetchDuration,
+		m.posts,
+		m.feedsOverdue,
+		m.lastSuccessCycle,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// fetchOutcome sorts a fetch error into one of the outcome labels
+func fetchOutcome(err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return outcomeOK
+	case errors.Is(err, errBodyTooLarge):
+		return outcomeTooLarge
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return outcomeTimeout
+	}
+	return outcomeError
+}
+
+// savedPosts counts the posts of a fetched feed, the ones that were neither
+// inserted nor updated were already stored
+func (m *aggMetrics) savedPosts(items int, result savePostsResult) {
+	m.posts.WithLabelValues("inserted").Add(float64(result.inserted))
+	m.posts.WithLabelValues("updated").Add(float64(result.updated))
+	m.posts.WithLabelValues("duplicate").Add(float64(max(items-result.inserted-result.updated, 0)))
+}
+
+// serveMetrics serves the metrics on /metrics at addr until the program
+// exits
+func serveMetrics(m *aggMetrics, addr string) (net.Addr, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return serveHTTP(addr, mux)
+}
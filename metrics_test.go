@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestMetrics(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+	srv.Set("/huge", feedtest.Huge(1<<20))
+	srv.Set("/broken", feedtest.Status(http.StatusInternalServerError))
+
+	e := newE2E(t, memory.New())
+	e.s.cfg.MaxBodyBytes = config.ByteSize(64 << 10)
+	e.run("register", "alice")
+	e.run("addfeed", "good", srv.FeedURL("/good"))
+	e.run("addfeed", "huge", srv.FeedURL("/huge"))
+	e.run("addfeed", "broken", srv.FeedURL("/broken"))
+
+	// One fetch of each feed, then the good feed again after it has a new post
+	e.agg(0, 0)
+	e.agg(0, 0)
+	e.agg(0, 0)
+	srv.Set("/good", feedtest.RSS("Good", feedtest.Item{Title: "three", GUID: "3"}, feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+	e.run("setinterval", srv.FeedURL("/good"), "1m")
+	e.clock = e.clock.Add(time.Minute)
+	e.agg(0, 0)
+
+	addr, err := serveMetrics(e.s.metrics, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + addr.String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`gator_feed_fetches_total{outcome="ok"} 2`,
+		`gator_feed_fetches_total{outcome="too_large"} 1`,
+		`gator_feed_fetches_total{outcome="error"} 1`,
+		"gator_feed_fetch_duration_seconds_count 4",
+		`gator_posts_total{result="inserted"} 3`,
+		`gator_posts_total{result="duplicate"} 2`,
+		"gator_feeds_overdue 0",
+		"gator_last_successful_cycle_timestamp_seconds ",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+func TestMiddlewareLoggedIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		users       []string
+		currentUser string
+		wantErr     bool
+	}{
+		{name: "logged in", users: []string{"alice", "bob"}, currentUser: "bob"},
+		{name: "user not in db", users: []string{"alice"}, currentUser: "carol", wantErr: true},
+		{name: "no current user", users: []string{"alice"}, currentUser: "", wantErr: true},
+		{name: "empty db", currentUser: "alice", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestState(t, tt.currentUser)
+			for _, name := range tt.users {
+				mustCreateUser(t, s, name)
+			}
+
+			called := false
+			handler := middlewareLoggedIn(func(s *state, cmd command, user database.User) error {
+				called = true
+				if user.Name != tt.currentUser {
+					t.Errorf("handler got user %s, want %s", user.Name, tt.currentUser)
+				}
+				return nil
+			})
+
+			err := handler(s, command{name: "test"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if called == tt.wantErr {
+				t.Errorf("handler called = %v, want %v", called, !tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// pruneBatchSize is how many posts one delete removes, small batches keep
+// each delete from holding its locks for long
+const pruneBatchSize = 500
+
+// retention is how many days and how many posts of a feed are kept, 0 keeps
+// them forever
+type retention struct {
+	days  int
+	posts int
+}
+
+// feedRetention is the retention set on the feed with setretention, or else
+// the post_retention_days and post_retention_posts settings
+func feedRetention(cfg *config.Config, feed database.Feed) retention {
+	r := retention{days: cfg.PostRetentionDays, posts: cfg.PostRetentionPosts}
+	if feed.RetentionDays.Valid {
+		r.days = int(feed.RetentionDays.Int32)
+	}
+	if feed.RetentionPosts.Valid {
+		r.posts = int(feed.RetentionPosts.Int32)
+	}
+	return r
+}
+
+func (r retention) keepsAll() bool {
+	return r.days == 0 && r.posts == 0
+}
+
+func (r retention) String() string {
+	switch {
+	case r.keepsAll():
+		return "forever"
+	case r.posts == 0:
+		return fmt.Sprintf("%d days", r.days)
+	case r.days == 0:
+		return fmt.Sprintf("the newest %d posts", r.posts)
+	}
+	return fmt.Sprintf("%d days, at most the newest %d posts", r.days, r.posts)
+}
+
+// prunePosts deletes the posts of a feed its retention doesn't keep, a batch
+// at a time. The days count from when gator stored a post, and the store
+// remembers the pruned posts so fetches don't save them again while the feed
+// still lists them. A dry run only counts the posts
+func prunePosts(ctx context.Context, db database.Querier, cfg *config.Config, feed database.Feed, now time.Time, dryRun bool) (int64, error) {
+	r := feedRetention(cfg, feed)
+	if r.keepsAll() {
+		return 0, nil
+	}
+
+	var storedBefore time.Time
+	if r.days > 0 {
+		storedBefore = now.AddDate(0, 0, -r.days)
+	}
+	if dryRun {
+		return db.CountPostsToPrune(ctx, database.CountPostsToPruneParams{
+			FeedID:       feed.ID,
+			StoredBefore: storedBefore,
+			KeepPosts:    int32(r.posts),
+		})
+	}
+
+	var total int64
+	for {
+		deleted, err := db.DeletePostsToPrune(ctx, database.DeletePostsToPruneParams{
+			FeedID:       feed.ID,
+			StoredBefore: storedBefore,
+			KeepPosts:    int32(r.posts),
+			BatchSize:    pruneBatchSize,
+			Now:          now,
+		})
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
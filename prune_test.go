@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/memory"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestFeedRetention(t *testing.T) {
+	set := func(n int32) sql.NullInt32 { return sql.NullInt32{Int32: n, Valid: true} }
+	tests := []struct {
+		name string
+		feed database.Feed
+		want retention
+		str  string
+	}{
+		{name: "global", want: retention{days: 30, posts: 0}, str: "30 days"},
+		{name: "feed days", feed: database.Feed{RetentionDays: set(7)}, want: retention{days: 7}, str: "7 days"},
+		{name: "feed posts", feed: database.Feed{RetentionPosts: set(100)}, want: retention{days: 30, posts: 100}, str: "30 days, at most the newest 100 posts"},
+		{name: "feed keeps everything", feed: database.Feed{RetentionDays: set(0), RetentionPosts: set(0)}, want: retention{}, str: "forever"},
+		{name: "only posts", feed: database.Feed{RetentionDays: set(0), RetentionPosts: set(10)}, want: retention{posts: 10}, str: "the newest 10 posts"},
+	}
+
+	cfg := config.Default()
+	cfg.PostRetentionDays = 30
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := feedRetention(&cfg, tt.feed)
+			if got != tt.want {
+				t.Errorf("feedRetention = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.str {
+				t.Errorf("String = %q, want %q", got.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestPrunePostsByAge(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.RSS("Blog", feedtest.Item{Title: "one", GUID: "1"}, feedtest.Item{Title: "two", GUID: "2"}))
+
+	e := newE2E(t, memory.New())
+	e.run("register", "alice")
+	e.run("addfeed", "blog", srv.FeedURL("/rss"))
+	e.agg(0, 0)
+	feed, err := e.s.db.GetFeedByUrl(context.Background(), srv.FeedURL("/rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Days count from when the posts were stored, which was just now
+	e.s.cfg.PostRetentionDays = 30
+
+	// alice follows the feed, so its posts are kept until alice has read them
+	old := time.Now().UTC().AddDate(0, 0, 31)
+	if got, err := prunePosts(context.Background(), e.s.db, e.s.cfg, feed, old, false); err != nil || got != 0 {
+		t.Errorf("prunePosts unread = %d, %v, want 0", got, err)
+	}
+	e.run("browse", "10")
+
+	for _, tt := range []struct {
+		name   string
+		now    time.Time
+		dryRun bool
+		want   int64
+	}{
+		{name: "too new", now: time.Now().UTC().AddDate(0, 0, 29), want: 0},
+		{name: "dry run", now: time.Now().UTC().AddDate(0, 0, 31), dryRun: true, want: 2},
+		{name: "old enough", now: time.Now().UTC().AddDate(0, 0, 31), want: 2},
+		{name: "already pruned", now: time.Now().UTC().AddDate(0, 0, 31), want: 0},
+	} {
+		got, err := prunePosts(context.Background(), e.s.db, e.s.cfg, feed, tt.now, tt.dryRun)
+		if err != nil || got != tt.want {
+			t.Errorf("prunePosts %s = %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+	if got := e.storedTitles(); len(got) != 0 {
+		t.Errorf("posts left after pruning %v, want none", got)
+	}
+}
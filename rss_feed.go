@@ -3,64 +3,205 @@ package main
 import (
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"html"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"golang.org/x/net/html/charset"
 )
 
 type RSSFeed struct {
+	// XMLName is the root element, which is <rss> for an RSS feed
+	XMLName xml.Name `json:"-"`
 	Channel struct {
 		Title       string    `xml:"title"`
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Item        []RSSItem `xml:"item"`
+		// How long the feed can be cached in minutes, and the hours (GMT)
+		// and days it asks not to be fetched in
+		TTL       string   `xml:"ttl"`
+		SkipHours []string `xml:"skipHours>hour"`
+		SkipDays  []string `xml:"skipDays>day"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	GUID        string         `xml:"guid"`
+	Author      string         `xml:"author"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string       `xml:"category"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// AuthorName returns the author of the item, falling back to dc:creator
+// which a lot of feeds use instead of the email style author element
+func (item *RSSItem) AuthorName() string {
+	if item.Author != "" {
+		return item.Author
+	}
+	return item.Creator
+}
+
+// trackingParams are query params that only track where a click came from,
+// feeds that change them would otherwise create duplicate posts
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"ref_src": true,
+}
+
+// Identity returns the key the post is stored under within its feed, the
+// guid if the feed has one, otherwise the normalized link
+func (item *RSSItem) Identity() string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return normalizeLink(item.Link)
+}
+
+// normalizeLink lower cases the scheme and host, drops default ports,
+// fragments and tracking params and sorts the query so the same article
+// always gets the same link
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)] {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// errBodyTooLarge is returned when a feed is bigger than max_body_bytes
+var errBodyTooLarge = errors.New("response body too large")
+
+// errUnsupportedFormat is returned for XML documents that aren't RSS, like
+// Atom feeds
+var errUnsupportedFormat = errors.New("unsupported feed format")
+
+// fetchStats is what the server sent back for a fetch
+type fetchStats struct {
+	// status is the HTTP status, 0 when no response came back
+	status int
+	// bytes is how much of the body was read, before it was decompressed
+	bytes int64
+}
+
+// fetchFeed downloads and parses a feed with the shared HTTP client
+func fetchFeed(ctx context.Context, s *state, feedURL string) (*RSSFeed, error) {
+	rssFeed, _, err := fetchFeedWithStats(ctx, s, feedURL)
+	return rssFeed, err
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+// fetchFeedWithStats is fetchFeed that also returns what the server sent,
+// even when the fetch fails
+func fetchFeedWithStats(ctx context.Context, s *state, feedURL string) (*RSSFeed, fetchStats, error) {
+	var stats fetchStats
+	maxBodyBytes := int64(s.cfg.MaxBodyBytes)
+
 	// Create the request
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
 	if err != nil {
-		return nil, err
+		return nil, stats, err
 	}
-	req.Header.Set("User-Agent", "gator")
+	req.Header.Set("User-Agent", s.cfg.UserAgent)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
 
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: 20 * time.Second,
+	// Wait our turn for the host
+	if err := s.hosts.wait(ctx, req.URL); err != nil {
+		return nil, stats, err
 	}
 
+	// Time the fetch without the wait for the host
+	start := time.Now()
+	defer func() {
+		s.metrics.fetchDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	// Perform the request
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, stats, err
 	}
 	defer resp.Body.Close()
+	stats.status = resp.StatusCode
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return nil, err
+		return nil, stats, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// Give up before reading anything if the server says it's too big
+	if resp.ContentLength > maxBodyBytes {
+		return nil, stats, fmt.Errorf("%w: Content-Length is %d bytes, the limit is %d (max_body_bytes)", errBodyTooLarge, resp.ContentLength, maxBodyBytes)
 	}
 
-	// Read the data from the response
-	body, err := io.ReadAll(resp.Body)
+	// Undo the compression, the limit is on the decompressed size so a
+	// small compressed body can't expand to fill up the memory
+	counted := &countingReader{r: resp.Body}
+	decoded, err := decodeBody(counted, resp.Header.Get("Content-Encoding"))
 	if err != nil {
-		return nil, err
+		stats.bytes = counted.n
+		return nil, stats, err
 	}
 
-	// Decode the xml into an RSSFeed
+	// Decode the xml into an RSSFeed as it is read, a body that goes past
+	// the limit stops the decoding instead of filling up the memory
+	body := &limitedReader{r: decoded, remaining: maxBodyBytes}
+	decoder := newFeedDecoder(body, resp.Header.Get("Content-Type"))
 	var rssFeed RSSFeed
-	err = xml.Unmarshal(body, &rssFeed)
+	err = decoder.Decode(&rssFeed)
+	stats.bytes = counted.n
+	if body.exceeded {
+		return nil, stats, fmt.Errorf("%w: more than %d bytes (max_body_bytes)", errBodyTooLarge, maxBodyBytes)
+	}
 	if err != nil {
-		return nil, err
+		return nil, stats, fmt.Errorf("failed to parse the feed: %w", err)
+	}
+	if rssFeed.XMLName.Local != "rss" {
+		return nil, stats, fmt.Errorf("%w: the root element is <%s>, only RSS is supported", errUnsupportedFormat, rssFeed.XMLName.Local)
 	}
 
 	// html Unescape all Title and Description fields
@@ -70,7 +211,83 @@ func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
 		item := &rssFeed.Channel.Item[i]
 		item.Title = html.UnescapeString(item.Title)
 		item.Description = html.UnescapeString(item.Description)
+		item.GUID = strings.TrimSpace(item.GUID)
+		item.Author = strings.TrimSpace(html.UnescapeString(item.Author))
+		item.Creator = strings.TrimSpace(html.UnescapeString(item.Creator))
+		for j := range item.Categories {
+			item.Categories[j] = strings.TrimSpace(html.UnescapeString(item.Categories[j]))
+		}
+	}
+
+	return &rssFeed, stats, nil
+}
+
+// newFeedDecoder returns an XML decoder that turns the body into UTF-8. The
+// charset in the Content-Type header wins over the one in the XML
+// declaration, like RFC 7303 says, unless it is one we don't know
+func newFeedDecoder(body io.Reader, contentType string) *xml.Decoder {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		if utf8Body, err := charsetReader(params["charset"], body); err == nil {
+			decoder := xml.NewDecoder(utf8Body)
+			// The body is UTF-8 already whatever the declaration says
+			decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+				return input, nil
+			}
+			return decoder
+		}
+	}
+
+	// Let the XML declaration pick the charset, it defaults to UTF-8
+	decoder := xml.NewDecoder(body)
+	decoder.CharsetReader = charsetReader
+	return decoder
+}
+
+// charsetReader converts input from the named charset to UTF-8, the names
+// are matched like browsers do so ISO-8859-1 is read as windows-1252
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	r, err := charset.NewReaderLabel(label, input)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	return r, nil
+}
+
+// limitedReader reads up to remaining bytes and then fails, unlike
+// io.LimitReader which ends quietly and makes a cut off body look complete
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only fail if there really is more to read
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			l.exceeded = true
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
 	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-	return &rssFeed, nil
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
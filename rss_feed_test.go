@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/feedtest"
+)
+
+func TestFetchFeedCharsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		// contentType replaces the one guessed from the fixture name
+		contentType     string
+		wantChannel     string
+		wantTitle       string
+		wantDescription string
+	}{
+		{
+			name:            "iso-8859-1 declaration",
+			fixture:         "latin1.rss",
+			wantChannel:     "Blog aus München",
+			wantTitle:       "Über Größe und Maß",
+			wantDescription: "Schöne Grüße aus der Straße",
+		},
+		{
+			name:            "windows-1252 declaration",
+			fixture:         "windows1252.rss",
+			wantChannel:     "Carnet de café",
+			wantTitle:       "L’été à Paris – 5 € le café",
+			wantDescription: "« Ça coûte cher », dit-il…",
+		},
+		{
+			// Feeds that say ISO-8859-1 but use the windows-1252 quotes
+			name:            "iso-8859-1 declaration with windows-1252 quotes",
+			fixture:         "latin1-cp1252-quotes.rss",
+			wantChannel:     "Blog de Ávila",
+			wantTitle:       "“Comillas” en el título",
+			wantDescription: "Año nuevo, señales nuevas",
+		},
+		{
+			name:            "shift_jis declaration",
+			fixture:         "shift_jis.rss",
+			wantChannel:     "日本語のブログ",
+			wantTitle:       "文字コードのテスト",
+			wantDescription: "シフトJISで書かれたフィード",
+		},
+		{
+			name:            "charset only in the content type",
+			fixture:         "koi8r-no-declaration.rss",
+			contentType:     "application/rss+xml; charset=KOI8-R",
+			wantChannel:     "Блог",
+			wantTitle:       "Привет, мир",
+			wantDescription: "Первая запись в блоге",
+		},
+		{
+			name:            "content type wins over the declaration",
+			fixture:         "utf8-wrong-declaration.rss",
+			contentType:     "text/xml; charset=utf-8",
+			wantChannel:     "Ärger",
+			wantTitle:       "Ärger mit der Kodierung",
+			wantDescription: "Die Datei ist UTF-8, die Deklaration lügt",
+		},
+		{
+			name:            "unknown charset in the content type falls back to the declaration",
+			fixture:         "latin1.rss",
+			contentType:     "application/rss+xml; charset=bogus",
+			wantChannel:     "Blog aus München",
+			wantTitle:       "Über Größe und Maß",
+			wantDescription: "Schöne Grüße aus der Straße",
+		},
+	}
+
+	srv := feedtest.NewServer(t)
+	s := newTestState(t, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := feedtest.Fixture(tt.fixture)
+			if tt.contentType != "" {
+				resp.ContentType = tt.contentType
+			}
+			srv.Set("/"+tt.fixture, resp)
+
+			feed, err := fetchFeed(context.Background(), s, srv.FeedURL("/"+tt.fixture))
+			if err != nil {
+				t.Fatalf("fetchFeed: %v", err)
+			}
+			if feed.Channel.Title != tt.wantChannel {
+				t.Errorf("channel title %q, want %q", feed.Channel.Title, tt.wantChannel)
+			}
+			if len(feed.Channel.Item) != 1 {
+				t.Fatalf("%d items, want 1", len(feed.Channel.Item))
+			}
+			item := feed.Channel.Item[0]
+			if item.Title != tt.wantTitle {
+				t.Errorf("title %q, want %q", item.Title, tt.wantTitle)
+			}
+			if item.Description != tt.wantDescription {
+				t.Errorf("description %q, want %q", item.Description, tt.wantDescription)
+			}
+			if !utf8.ValidString(item.Title) || !utf8.ValidString(item.Description) {
+				t.Errorf("item is not valid UTF-8: %+v", item)
+			}
+		})
+	}
+}
+
+func TestFetchFeedCompression(t *testing.T) {
+	feed := feedtest.RSS("Blog",
+		feedtest.Item{Title: "one", GUID: "1"},
+		feedtest.Item{Title: "two", GUID: "2"},
+	)
+
+	srv := feedtest.NewServer(t)
+	s := newTestState(t, "")
+	s.cfg.UserAgent = "gator-test/1.0"
+
+	for _, encoding := range []string{"identity", "gzip", "deflate", "deflate-raw", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			resp := feed
+			if encoding != "identity" {
+				resp = feedtest.Compressed(encoding, feed)
+			}
+			srv.Set("/"+encoding, resp)
+
+			got, err := fetchFeed(context.Background(), s, srv.FeedURL("/"+encoding))
+			if err != nil {
+				t.Fatalf("fetchFeed: %v", err)
+			}
+			if len(got.Channel.Item) != 2 || got.Channel.Item[1].Title != "two" {
+				t.Errorf("items %+v, want one and two", got.Channel.Item)
+			}
+
+			header := srv.Header("/" + encoding)
+			if ua := header.Get("User-Agent"); ua != "gator-test/1.0" {
+				t.Errorf("User-Agent %q, want the configured one", ua)
+			}
+			if ae := header.Get("Accept-Encoding"); ae != acceptEncoding {
+				t.Errorf("Accept-Encoding %q, want %q", ae, acceptEncoding)
+			}
+		})
+	}
+
+	// The connection is kept alive and reused by every fetch
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("%d connections opened, want 1", got)
+	}
+}
+
+func TestFetchFeedCompressedBodyLimit(t *testing.T) {
+	// A small compressed body that expands past the limit
+	resp := feedtest.Huge(4 << 20)
+	resp.Body += strings.Repeat("x", 4<<20) + resp.Trailer
+	resp.Padding, resp.Trailer = 0, ""
+	resp = feedtest.Compressed("gzip", resp)
+	if len(resp.Body) > 1<<20 {
+		t.Fatalf("compressed body is %d bytes, the test needs it under the limit", len(resp.Body))
+	}
+
+	srv := feedtest.NewServer(t)
+	srv.Set("/bomb", resp)
+	s := newTestState(t, "")
+	s.cfg.MaxBodyBytes = 1 << 20
+
+	_, err := fetchFeed(context.Background(), s, srv.FeedURL("/bomb"))
+	if !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("fetchFeed = %v, want errBodyTooLarge", err)
+	}
+}
+
+func TestFetchFeedUnsupportedEncoding(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	resp := feedtest.RSS("Blog")
+	resp.Headers = map[string]string{"Content-Encoding": "zstd"}
+	srv.Set("/zstd", resp)
+
+	_, err := fetchFeed(context.Background(), newTestState(t, ""), srv.FeedURL("/zstd"))
+	if err == nil || !strings.Contains(err.Error(), `unsupported Content-Encoding "zstd"`) {
+		t.Errorf("fetchFeed = %v, want an unsupported encoding error", err)
+	}
+}
+
+// extrasFeed has items with a dc:creator, several categories and enclosures,
+// one of them with no length
+const extrasFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+<title>Podcast</title>
+<item>
+	<title>Episode 1</title>
+	<link>https://example.com/1</link>
+	<guid>ep-1</guid>
+	<dc:creator> Jane Doe </dc:creator>
+	<category>Go</category>
+	<category> Tips &amp; Tricks </category>
+	<enclosure url="https://example.com/1.mp3" length="12345" type="audio/mpeg"/>
+	<enclosure url="https://example.com/1.jpg" type="image/jpeg"/>
+</item>
+<item>
+	<title>Episode 2</title>
+	<link>https://example.com/2</link>
+	<guid>ep-2</guid>
+	<author>bob@example.com (Bob)</author>
+	<dc:creator>Jane Doe</dc:creator>
+</item>
+</channel>
+</rss>`
+
+func TestRSSItemExtras(t *testing.T) {
+	srv := feedtest.NewServer(t)
+	srv.Set("/rss", feedtest.Response{ContentType: "application/rss+xml", Body: extrasFeed})
+
+	feed, err := fetchFeed(context.Background(), newTestState(t, ""), srv.FeedURL("/rss"))
+	if err != nil {
+		t.Fatalf("fetchFeed: %v", err)
+	}
+	if len(feed.Channel.Item) != 2 {
+		t.Fatalf("%d items, want 2", len(feed.Channel.Item))
+	}
+	first, second := feed.Channel.Item[0], feed.Channel.Item[1]
+
+	// dc:creator is only used when there is no author
+	if got := first.AuthorName(); got != "Jane Doe" {
+		t.Errorf("first author %q, want the dc:creator", got)
+	}
+	if got := second.AuthorName(); got != "bob@example.com (Bob)" {
+		t.Errorf("second author %q, want the author element", got)
+	}
+
+	if want := []string{"Go", "Tips & Tricks"}; !slices.Equal(first.Categories, want) {
+		t.Errorf("categories %q, want %q", first.Categories, want)
+	}
+	wantEnclosures := []RSSEnclosure{
+		{URL: "https://example.com/1.mp3", Length: "12345", Type: "audio/mpeg"},
+		{URL: "https://example.com/1.jpg", Type: "image/jpeg"},
+	}
+	if !slices.Equal(first.Enclosures, wantEnclosures) {
+		t.Errorf("enclosures %+v, want %+v", first.Enclosures, wantEnclosures)
+	}
+	if len(second.Categories) != 0 || len(second.Enclosures) != 0 {
+		t.Errorf("second item has categories %q and enclosures %+v, want none", second.Categories, second.Enclosures)
+	}
+
+	// Saved, the enclosure with no length has a NULL length
+	for name, open := range e2eStores(t) {
+		t.Run(name, func(t *testing.T) {
+			e := newE2E(t, open(t))
+			e.run("register", "alice")
+			e.run("addfeed", "podcast", srv.FeedURL("/rss"))
+			e.agg(0, 0)
+
+			post := storedPost(t, e, "ep-1")
+			categories, err := e.s.db.GetPostCategories(context.Background(), post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(categories)
+			if want := []string{"Go", "Tips & Tricks"}; !slices.Equal(categories, want) {
+				t.Errorf("stored categories %q, want %q", categories, want)
+			}
+
+			enclosures, err := e.s.db.GetPostEnclosures(context.Background(), post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lengths := make(map[string]sql.NullInt64)
+			for _, enclosure := range enclosures {
+				lengths[enclosure.Url] = enclosure.Length
+			}
+			if got := lengths["https://example.com/1.mp3"]; got != (sql.NullInt64{Int64: 12345, Valid: true}) {
+				t.Errorf("mp3 length %+v, want 12345", got)
+			}
+			if got, ok := lengths["https://example.com/1.jpg"]; !ok || got.Valid {
+				t.Errorf("jpg length %+v (stored %v), want NULL", got, ok)
+			}
+			if post.Author.String != "Jane Doe" {
+				t.Errorf("stored author %q, want Jane Doe", post.Author.String)
+			}
+		})
+	}
+}
+
+// storedPost returns the post with a guid from the posts the current user
+// can browse
+func storedPost(t *testing.T, e *e2e, guid string) database.GetPostsForUserRow {
+	t.Helper()
+	user, err := e.s.db.GetUser(context.Background(), e.s.cfg.CurrentUserName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := e.s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if post.Guid == guid {
+			return post
+		}
+	}
+	t.Fatalf("no post with guid %s", guid)
+	return database.GetPostsForUserRow{}
+}
+
+func TestNormalizeLink(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{name: "already normal", link: "https://example.com/posts/1", want: "https://example.com/posts/1"},
+		{name: "surrounding space", link: "  https://example.com/posts/1\n", want: "https://example.com/posts/1"},
+		{name: "scheme and host case", link: "HTTPS://Example.COM/Posts/1", want: "https://example.com/Posts/1"},
+		{name: "default http port", link: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "default https port", link: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "other port kept", link: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "https port on http kept", link: "http://example.com:443/a", want: "http://example.com:443/a"},
+		{name: "fragment", link: "https://example.com/a#comments", want: "https://example.com/a"},
+		{name: "utm params", link: "https://example.com/a?utm_source=rss&utm_medium=feed&UTM_Campaign=x", want: "https://example.com/a"},
+		{name: "tracking params", link: "https://example.com/a?fbclid=1&gclid=2&dclid=3&msclkid=4&yclid=5&igshid=6&mc_cid=7&mc_eid=8&_hsenc=9&_hsmi=10&ref_src=11", want: "https://example.com/a"},
+		{name: "tracking params any case", link: "https://example.com/a?FBCLID=1&id=2", want: "https://example.com/a?id=2"},
+		{name: "other params kept", link: "https://example.com/a?id=7&utm_source=rss&page=2", want: "https://example.com/a?id=7&page=2"},
+		{name: "query sorted", link: "https://example.com/a?b=2&a=1&c=3", want: "https://example.com/a?a=1&b=2&c=3"},
+		{name: "everything at once", link: "HTTP://Example.com:80/a?z=1&utm_source=x&a=2#top", want: "http://example.com/a?a=2&z=1"},
+		{name: "unparseable", link: "http://[::1/a?utm_source=x", want: "http://[::1/a?utm_source=x"},
+		{name: "no host", link: "/posts/1?utm_source=x", want: "/posts/1?utm_source=x"},
+		{name: "empty", link: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeLink(tt.link); got != tt.want {
+				t.Errorf("normalizeLink(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRSSItemIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		item RSSItem
+		want string
+	}{
+		{name: "guid wins over the link", item: RSSItem{GUID: "post-1", Link: "https://example.com/1"}, want: "post-1"},
+		{name: "guid is not normalized", item: RSSItem{GUID: "HTTPS://Example.com/1?utm_source=x"}, want: "HTTPS://Example.com/1?utm_source=x"},
+		{name: "guid with no link", item: RSSItem{GUID: "post-1"}, want: "post-1"},
+		{name: "normalized link without a guid", item: RSSItem{Link: "HTTPS://Example.com/1?utm_source=x#top"}, want: "https://example.com/1"},
+		{name: "neither", item: RSSItem{Title: "no identity"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.item.Identity(); got != tt.want {
+				t.Errorf("Identity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// postBatchSize is how many posts are sent to the DB in one statement
+const postBatchSize = 100
+
+type savePostsResult struct {
+	inserted int
+	updated  int
+}
+
+// savePosts upserts the items of a feed in batches, along with the
+// categories and enclosures of the new and edited posts
+func savePosts(ctx context.Context, q database.Querier, feedID uuid.UUID, items []RSSItem, batchSize int) (savePostsResult, error) {
+	var result savePostsResult
+	now := time.Now().UTC()
+
+	// Posts are identified by their guid within the feed, a guid can only be
+	// in a batch once so feeds that repeat an item keep the first one
+	seen := make(map[string]bool)
+	unique := make([]RSSItem, 0, len(items))
+	for _, item := range items {
+		guid := item.Identity()
+		if guid == "" {
+			slog.Warn("skipping post with no guid or link", "feed_id", feedID, "title", item.Title)
+			continue
+		}
+		if seen[guid] {
+			continue
+		}
+		seen[guid] = true
+		unique = append(unique, item)
+	}
+
+	// Only the feeds migration 016 listed have posts stored under their raw
+	// url, each is fixed up on its first save after the migration
+	legacy, err := q.TakeLegacyGuidFeed(ctx, feedID)
+	if err != nil {
+		return result, err
+	}
+
+	for start := 0; start < len(unique); start += batchSize {
+		batch := unique[start:min(start+batchSize, len(unique))]
+
+		params := database.UpsertPostsParams{
+			Now:    now,
+			FeedID: feedID,
+		}
+		for _, item := range batch {
+			// parse the publishedAt time, the zero time is stored as NULL
+			publishedAt := time.Time{}
+			parsedTime, err := time.Parse(time.RFC1123Z, item.PubDate)
+			if err == nil {
+				publishedAt = parsedTime.UTC()
+			} else {
+				slog.Debug("failed to parse published at", "feed_id", feedID, "pub_date", item.PubDate, "error", err)
+			}
+
+			params.Ids = append(params.Ids, uuid.New())
+			params.Titles = append(params.Titles, item.Title)
+			params.Urls = append(params.Urls, item.Link)
+			params.Descriptions = append(params.Descriptions, item.Description)
+			params.PublishedAts = append(params.PublishedAts, publishedAt)
+			params.Contents = append(params.Contents, item.Content)
+			params.Guids = append(params.Guids, item.Identity())
+			params.Authors = append(params.Authors, item.AuthorName())
+			params.ContentHashes = append(params.ContentHashes, contentHash(item.Title, item.Description, item.Content, publishedAt))
+		}
+
+		// Posts saved before guids were used go under the guid they have now
+		// instead of being saved again
+		if legacy > 0 {
+			moved, err := q.UpdateLegacyPostGuids(ctx, database.UpdateLegacyPostGuidsParams{
+				Urls:   params.Urls,
+				Guids:  params.Guids,
+				FeedID: feedID,
+			})
+			if err != nil {
+				return result, err
+			}
+			if moved > 0 {
+				slog.Info("moved legacy posts to their guid", "feed_id", feedID, "posts", moved)
+			}
+		}
+
+		rows, err := q.UpsertPosts(ctx, params)
+		if err != nil {
+			return result, err
+		}
+
+		// Only the new and edited posts come back
+		postIDs := make(map[string]uuid.UUID, len(rows))
+		for _, row := range rows {
+			postIDs[row.Guid] = row.ID
+			if row.Inserted {
+				result.inserted++
+			} else {
+				result.updated++
+			}
+		}
+		if len(postIDs) == 0 {
+			continue
+		}
+
+		err = savePostExtras(ctx, q, now, batch, postIDs)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	// Pruned posts the feed no longer lists can't come back, so they don't
+	// need to be skipped any more
+	if len(seen) > 0 {
+		guids := make([]string, 0, len(seen))
+		for guid := range seen {
+			guids = append(guids, guid)
+		}
+		_, err := q.ForgetPrunedPosts(ctx, database.ForgetPrunedPostsParams{FeedID: feedID, Guids: guids})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// savePostExtras saves the categories and enclosures of the items that were
+// new or edited
+func savePostExtras(ctx context.Context, q database.Querier, now time.Time, items []RSSItem, postIDs map[string]uuid.UUID) error {
+	categories := database.CreatePostCategoriesParams{Now: now}
+	enclosures := database.CreatePostEnclosuresParams{Now: now}
+
+	for _, item := range items {
+		postID, ok := postIDs[item.Identity()]
+		if !ok {
+			continue
+		}
+
+		for _, category := range item.Categories {
+			if category == "" {
+				continue
+			}
+			categories.PostIds = append(categories.PostIds, postID)
+			categories.Names = append(categories.Names, category)
+		}
+
+		for _, enclosure := range item.Enclosures {
+			if enclosure.URL == "" {
+				continue
+			}
+			// An unknown length is stored as NULL
+			length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+			enclosures.PostIds = append(enclosures.PostIds, postID)
+			enclosures.Urls = append(enclosures.Urls, enclosure.URL)
+			enclosures.Lengths = append(enclosures.Lengths, length)
+			enclosures.MimeTypes = append(enclosures.MimeTypes, enclosure.Type)
+		}
+	}
+
+	if len(categories.PostIds) > 0 {
+		if err := q.CreatePostCategories(ctx, categories); err != nil {
+			return err
+		}
+	}
+	if len(enclosures.PostIds) > 0 {
+		if err := q.CreatePostEnclosures(ctx, enclosures); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentHash returns a hash of the fields that are updated when a feed
+// edits a post
+func contentHash(title, description, content string, publishedAt time.Time) string {
+	hash := sha256.New()
+	published := ""
+	if !publishedAt.IsZero() {
+		published = publishedAt.UTC().Format(time.RFC3339)
+	}
+	for _, field := range []string{title, description, content, published} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	_ "github.com/lib/pq"
+)
+
+// testDBURLEnv points at a migrated Postgres DB the tests can write to,
+// tests that need Postgres are skipped when it isn't set
+const testDBURLEnv = "GATOR_TEST_DB_URL"
+
+// benchmarkFeedItems is the size of the feed saved in each iteration
+const benchmarkFeedItems = 200
+
+// BenchmarkSavePosts compares saving a feed one post per statement with
+// saving it in batches, each iteration is one fetch saved in a transaction
+func BenchmarkSavePosts(b *testing.B) {
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		b.Skipf("%s not set", testDBURLEnv)
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	q := database.New(db)
+
+	// Create a user and feed to save the posts in, deleting the user
+	// cascades to everything else
+	ctx := context.Background()
+	user, err := q.CreateUser(ctx, database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      "bench-" + uuid.NewString(),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id = $1", user.ID)
+
+	feed, err := q.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      "bench",
+		Url:       "https://example.com/" + uuid.NewString(),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, batchSize := range []int{1, 10, postBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", batchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				items := benchmarkItems(benchmarkFeedItems)
+				b.StartTimer()
+
+				tx, err := db.BeginTx(ctx, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				result, err := savePosts(ctx, q.WithTx(tx), feed.ID, items, batchSize)
+				if err != nil {
+					tx.Rollback()
+					b.Fatal(err)
+				}
+				if err := tx.Commit(); err != nil {
+					b.Fatal(err)
+				}
+				if result.inserted != len(items) {
+					b.Fatalf("inserted %d posts, want %d", result.inserted, len(items))
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Microseconds())/float64(b.N*benchmarkFeedItems), "µs/post")
+		})
+	}
+}
+
+func benchmarkItems(n int) []RSSItem {
+	items := make([]RSSItem, n)
+	for i := range items {
+		id := uuid.NewString()
+		items[i] = RSSItem{
+			Title:       "Post " + id,
+			Link:        "https://example.com/posts/" + id,
+			Description: "Description of post " + id,
+			PubDate:     time.Now().UTC().Format(time.RFC1123Z),
+			GUID:        id,
+			Categories:  []string{"go", "bench"},
+		}
+	}
+	return items
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+)
+
+// cadencePosts is how many of the newest posts the publish cadence of a
+// feed is worked out from
+const cadencePosts = 20
+
+// scheduleNextFetch works out when a feed fetched at from is fetched again
+// and why
+func scheduleNextFetch(ctx context.Context, q database.Querier, cfg *config.Config, feed database.Feed, from time.Time) (time.Time, string, error) {
+	interval, reason, err := fetchInterval(ctx, q, cfg, feed, from)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	next := nextFetchAt(from, interval, feed.SkipHours, feed.SkipDays)
+	if !next.Equal(from.Add(interval).UTC()) {
+		reason += ", moved out of the feed's skipHours and skipDays"
+	}
+	return next, reason, nil
+}
+
+// fetchInterval is how often the feed is fetched and why, the interval set
+// with setinterval, then how often the feed publishes, then its ttl and
+// finally the default_fetch_interval setting
+func fetchInterval(ctx context.Context, q database.Querier, cfg *config.Config, feed database.Feed, now time.Time) (time.Duration, string, error) {
+	if feed.FetchInterval.Valid {
+		return time.Duration(feed.FetchInterval.Int32) * time.Second, "set with setinterval", nil
+	}
+
+	published, err := q.GetRecentPublishTimes(ctx, database.GetRecentPublishTimesParams{
+		FeedID:   feed.ID,
+		Now:      now,
+		MaxPosts: cadencePosts,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get the publish times: %w", err)
+	}
+
+	ttl := time.Duration(feed.Ttl.Int32) * time.Minute
+	if len(published) >= 2 {
+		interval, reason := adaptiveInterval(cfg, published, now)
+		// The feed asked not to be fetched more often than its ttl
+		if interval < ttl {
+			return ttl, reason + fmt.Sprintf(", raised to the feed ttl of %d minutes", feed.Ttl.Int32), nil
+		}
+		return interval, reason, nil
+	}
+
+	if feed.Ttl.Valid {
+		return ttl, fmt.Sprintf("feed ttl of %d minutes", feed.Ttl.Int32), nil
+	}
+	return time.Duration(cfg.DefaultFetchInterval), "default_fetch_interval, not enough dated posts to learn from", nil
+}
+
+// adaptiveInterval fetches a feed twice per average gap between its posts.
+// A feed that has been quiet for longer than that gap uses the time since
+// its last post instead, so dormant feeds are fetched less and less often.
+// published is newest first and has at least two dates
+func adaptiveInterval(cfg *config.Config, published []sql.NullTime, now time.Time) (time.Duration, string) {
+	newest, oldest := published[0].Time, published[len(published)-1].Time
+	gap := newest.Sub(oldest) / time.Duration(len(published)-1)
+	reason := fmt.Sprintf("a post every %s on average over the last %d posts", formatDuration(gap), len(published))
+	if quiet := now.Sub(newest); quiet > gap {
+		gap = quiet
+		reason = fmt.Sprintf("no post for %s", formatDuration(quiet))
+	}
+
+	interval := gap / 2
+	reason += fmt.Sprintf(", fetching every %s", formatDuration(interval))
+	// The minimum wins if the bounds are the wrong way round
+	if maxInterval := time.Duration(cfg.MaxFetchInterval); interval > maxInterval {
+		interval = maxInterval
+		reason += fmt.Sprintf(", capped at max_fetch_interval %v", maxInterval)
+	}
+	if minInterval := time.Duration(cfg.MinFetchInterval); interval < minInterval {
+		interval = minInterval
+		reason += fmt.Sprintf(", raised to min_fetch_interval %v", minInterval)
+	}
+	return interval, reason
+}
+
+// formatDuration rounds a duration to what is worth showing, long ones are
+// written in days
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", d.Round(24*time.Hour)/(24*time.Hour))
+	case d >= time.Hour:
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// nextFetchAt is when a feed fetched at from should be fetched again. Times
+// in the hours and days the feed asks to be skipped move on to the start of
+// the next hour that isn't skipped
+func nextFetchAt(from time.Time, interval time.Duration, skipHours, skipDays int32) time.Time {
+	next := from.Add(interval).UTC()
+	// A week of hours is enough to find one that isn't skipped, a feed that
+	// skips all of them is fetched on its interval anyway
+	for range 7 * 24 {
+		if skipHours&(1<<next.Hour()) == 0 && skipDays&(1<<int(next.Weekday())) == 0 {
+			return next
+		}
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return from.Add(interval).UTC()
+}
+
+// parseTTL reads the <ttl> of a feed, the minutes it can be cached for
+func parseTTL(ttl string) sql.NullInt32 {
+	minutes, err := strconv.ParseInt(strings.TrimSpace(ttl), 10, 32)
+	if err != nil || minutes <= 0 {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(minutes), Valid: true}
+}
+
+// skipHoursMask turns the <skipHours> of a feed into a bit mask, bit n is
+// hour n GMT. Some feeds write midnight as 24
+func skipHoursMask(hours []string) int32 {
+	var mask int32
+	for _, hour := range hours {
+		n, err := strconv.Atoi(strings.TrimSpace(hour))
+		if err != nil || n < 0 || n > 24 {
+			continue
+		}
+		mask |= 1 << (n % 24)
+	}
+	return mask
+}
+
+// skipDaysMask turns the <skipDays> of a feed into a bit mask, bit n is
+// time.Weekday n
+func skipDaysMask(days []string) int32 {
+	var mask int32
+	for _, day := range days {
+		for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+			if strings.EqualFold(strings.TrimSpace(day), weekday.String()) {
+				mask |= 1 << int(weekday)
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+)
+
+func TestNextFetchAt(t *testing.T) {
+	// A Sunday at noon
+	from := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		skipHours []string
+		skipDays  []string
+		want      time.Time
+	}{
+		{name: "no skips", interval: 90 * time.Minute, want: from.Add(90 * time.Minute)},
+		{name: "skipped hour", interval: 30 * time.Minute, skipHours: []string{"12"}, want: from.Add(time.Hour)},
+		{name: "skipped hours in a row", interval: 30 * time.Minute, skipHours: []string{"12", "13", " 14 "}, want: from.Add(3 * time.Hour)},
+		{name: "midnight written as 24", interval: 12 * time.Hour, skipHours: []string{"24"}, want: from.Add(13 * time.Hour)},
+		{name: "skipped day", interval: time.Hour, skipDays: []string{"Sunday"}, want: from.Add(12 * time.Hour)},
+		{name: "skipped days and hours", interval: time.Hour, skipHours: []string{"0", "1"}, skipDays: []string{"sunday", "Monday"}, want: from.Add(38 * time.Hour)},
+		{name: "everything skipped", interval: time.Hour, skipDays: []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}, want: from.Add(time.Hour)},
+		{name: "junk is ignored", interval: time.Hour, skipHours: []string{"noon", "25", "-1"}, skipDays: []string{"Someday"}, want: from.Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextFetchAt(from, tt.interval, skipHoursMask(tt.skipHours), skipDaysMask(tt.skipDays))
+			if !got.Equal(tt.want) {
+				t.Errorf("nextFetchAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		ttl   string
+		want  int32
+		valid bool
+	}{
+		{ttl: "60", want: 60, valid: true},
+		{ttl: " 15\n", want: 15, valid: true},
+		{ttl: "", valid: false},
+		{ttl: "0", valid: false},
+		{ttl: "-5", valid: false},
+		{ttl: "an hour", valid: false},
+	}
+
+	for _, tt := range tests {
+		got := parseTTL(tt.ttl)
+		if got.Valid != tt.valid || got.Int32 != tt.want {
+			t.Errorf("parseTTL(%q) = %+v, want %d valid %v", tt.ttl, got, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cfg := config.Default()
+
+	// every returns n publish dates gap apart, newest first, the newest ago
+	// before now
+	every := func(n int, gap, ago time.Duration) []sql.NullTime {
+		var published []sql.NullTime
+		for i := range n {
+			published = append(published, sql.NullTime{Time: now.Add(-ago - time.Duration(i)*gap), Valid: true})
+		}
+		return published
+	}
+
+	tests := []struct {
+		name       string
+		published  []sql.NullTime
+		want       time.Duration
+		wantReason string
+	}{
+		{name: "twice per gap", published: every(10, 6*time.Hour, time.Hour), want: 3 * time.Hour, wantReason: "a post every 6h0m0s"},
+		{name: "busy feed raised to the minimum", published: every(20, 5*time.Minute, 0), want: 15 * time.Minute, wantReason: "raised to min_fetch_interval"},
+		{name: "quiet feed backs off", published: every(2, time.Hour, 10*time.Hour), want: 5 * time.Hour, wantReason: "no post for 10h0m0s"},
+		{name: "dormant feed capped at the maximum", published: every(5, time.Hour, 30*24*time.Hour), want: 24 * time.Hour, wantReason: "no post for 30 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := adaptiveInterval(&cfg, tt.published, now)
+			if got != tt.want {
+				t.Errorf("adaptiveInterval = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("adaptiveInterval reason %q, want one containing %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -16,14 +16,75 @@ SELECT * FROM feeds;
 -- name: GetFeedByUrl :one
 SELECT * FROM feeds WHERE url = $1;
 
+-- name: GetFeedsToFetch :many
+SELECT *
+FROM feeds
+WHERE next_fetch_at IS NULL OR next_fetch_at <= @now::timestamp
+ORDER BY next_fetch_at ASC NULLS FIRST;
+
+-- name: GetFollowedFeedsToFetch :many
+-- Feeds nobody follows are left out
+SELECT *
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= @now::timestamp)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST;
+
+-- name: GetUserFeedsToFetch :many
+SELECT feeds.*
+FROM feeds
+INNER JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = @user_id
+AND (feeds.next_fetch_at IS NULL OR feeds.next_fetch_at <= @now::timestamp)
+ORDER BY feeds.next_fetch_at ASC NULLS FIRST;
+
 -- name: MarkFeedFetched :one
 UPDATE feeds
-SET updated_at = $2, last_fetched_at = $3
+SET updated_at = $2, last_fetched_at = $3, last_fetch_error = NULL,
+    next_fetch_at = $4, ttl = $5, skip_hours = $6, skip_days = $7, schedule_reason = $8
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkFeedFetchFailed :one
+UPDATE feeds
+SET updated_at = $2, last_fetched_at = $3, last_fetch_error = $4,
+    next_fetch_at = $5, schedule_reason = $6
 WHERE id = $1
 RETURNING *;
 
 -- name: GetNextFeedToFetch :one
 SELECT *
 FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT 1;
\ No newline at end of file
+WHERE next_fetch_at IS NULL OR next_fetch_at <= @now::timestamp
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1;
+
+-- name: GetNextFollowedFeedToFetch :one
+-- Feeds nobody follows are left out
+SELECT *
+FROM feeds
+WHERE (next_fetch_at IS NULL OR next_fetch_at <= @now::timestamp)
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+ORDER BY next_fetch_at ASC NULLS FIRST
+LIMIT 1;
+
+-- name: GetNextUserFeedToFetch :one
+SELECT feeds.*
+FROM feeds
+INNER JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = @user_id
+AND (feeds.next_fetch_at IS NULL OR feeds.next_fetch_at <= @now::timestamp)
+ORDER BY feeds.next_fetch_at ASC NULLS FIRST
+LIMIT 1;
+
+-- name: SetFeedFetchInterval :one
+UPDATE feeds
+SET updated_at = $2, fetch_interval = $3, next_fetch_at = $4, schedule_reason = $5
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFeedRetention :one
+UPDATE feeds
+SET updated_at = $2, retention_days = $3, retention_posts = $4
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,5 @@
+-- name: TakeLegacyGuidFeed :execrows
+-- Takes a feed off legacy_guid_feeds, 1 row means its posts still need
+-- UpdateLegacyPostGuids
+DELETE FROM legacy_guid_feeds
+WHERE feed_id = $1;
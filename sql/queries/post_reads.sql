@@ -0,0 +1,9 @@
+-- name: MarkPostRead :exec
+-- Reading a post twice keeps the first read
+INSERT INTO post_reads (id, created_at, user_id, post_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = $1 AND post_id = $2;
@@ -0,0 +1,15 @@
+-- name: StarPost :exec
+-- Starring a post twice keeps the first star
+INSERT INTO post_stars (id, created_at, user_id, post_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: UnstarPost :execrows
+DELETE FROM post_stars
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: IsPostStarred :one
+SELECT EXISTS (
+    SELECT 1 FROM post_stars
+    WHERE user_id = $1 AND post_id = $2
+);
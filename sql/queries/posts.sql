@@ -1,7 +1,71 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING *;
+-- name: UpsertPosts :many
+-- Inserts a batch of posts for a feed, or updates the posts whose content
+-- hash changed. The old versions are saved in post_revisions first and
+-- unchanged posts return no row. Posts in pruned_posts are skipped. Empty
+-- strings and the zero time are NULL
+WITH incoming AS (
+    SELECT *
+    FROM unnest(
+        @ids::uuid[],
+        @titles::text[],
+        @urls::text[],
+        @descriptions::text[],
+        @published_ats::timestamp[],
+        @contents::text[],
+        @guids::text[],
+        @authors::text[],
+        @content_hashes::text[]
+    ) AS t(id, title, url, description, published_at, content, guid, author, content_hash)
+),
+revision AS (
+    INSERT INTO post_revisions (id, created_at, post_id, title, description, content, published_at, content_hash)
+    SELECT gen_random_uuid(), @now::timestamp, posts.id, posts.title, posts.description, posts.content, posts.published_at, posts.content_hash
+    FROM posts
+    INNER JOIN incoming ON incoming.guid = posts.guid
+    WHERE posts.feed_id = @feed_id::uuid
+    AND posts.content_hash <> '' AND posts.content_hash <> incoming.content_hash
+)
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, guid, author, content_hash)
+SELECT
+    incoming.id,
+    @now::timestamp,
+    @now::timestamp,
+    incoming.title,
+    incoming.url,
+    NULLIF(incoming.description, ''),
+    NULLIF(incoming.published_at, '0001-01-01 00:00:00'::timestamp),
+    @feed_id::uuid,
+    NULLIF(incoming.content, ''),
+    incoming.guid,
+    NULLIF(incoming.author, ''),
+    incoming.content_hash
+FROM incoming
+WHERE NOT EXISTS (
+    SELECT 1 FROM pruned_posts
+    WHERE pruned_posts.feed_id = @feed_id::uuid AND pruned_posts.guid = incoming.guid
+)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    published_at = EXCLUDED.published_at,
+    content_hash = EXCLUDED.content_hash
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING posts.id, posts.guid, (xmax = 0) AS inserted;
+--
+
+-- name: GetPost :one
+SELECT posts.*, feeds.name as feed_name
+FROM posts
+INNER JOIN feeds ON posts.feed_id = feeds.id
+WHERE posts.id = $1;
+--
+
+-- name: GetPostRevisions :many
+SELECT * FROM post_revisions
+WHERE post_id = $1
+ORDER BY created_at DESC;
 --
 
 -- name: GetPostsForUser :many
@@ -12,4 +76,117 @@ INNER JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 WHERE feed_follows.user_id = $1
 ORDER BY published_at DESC
 LIMIT $2;
---
\ No newline at end of file
+--
+
+-- name: CreatePostCategories :exec
+INSERT INTO post_categories (id, created_at, post_id, name)
+SELECT gen_random_uuid(), @now::timestamp, t.post_id, t.name
+FROM unnest(@post_ids::uuid[], @names::text[]) AS t(post_id, name)
+ON CONFLICT (post_id, name) DO NOTHING;
+--
+
+-- name: CreatePostEnclosures :exec
+-- A length of 0 and an empty mime type are stored as NULL
+INSERT INTO post_enclosures (id, created_at, post_id, url, length, mime_type)
+SELECT gen_random_uuid(), @now::timestamp, t.post_id, t.url, NULLIF(t.length, 0), NULLIF(t.mime_type, '')
+FROM unnest(@post_ids::uuid[], @urls::text[], @lengths::bigint[], @mime_types::text[]) AS t(post_id, url, length, mime_type)
+ON CONFLICT (post_id, url) DO NOTHING;
+--
+
+-- name: GetPostCategories :many
+SELECT name FROM post_categories
+WHERE post_id = $1
+ORDER BY name;
+--
+
+-- name: GetPostEnclosures :many
+SELECT * FROM post_enclosures
+WHERE post_id = $1
+ORDER BY url;
+--
+
+-- name: GetRecentPublishTimes :many
+-- The publish dates of the newest posts of a feed, dates after now are
+-- left out since they can't be trusted
+SELECT published_at FROM posts
+WHERE feed_id = @feed_id::uuid AND published_at IS NOT NULL AND published_at <= @now::timestamp
+ORDER BY published_at DESC
+LIMIT @max_posts::int;
+--
+
+-- name: CountPostsToPrune :one
+-- The posts of a feed stored before stored_before or not among its newest
+-- keep_posts posts, a keep_posts of 0 keeps any number. Newest is by publish
+-- date, or when the post was stored if it has none. Posts someone starred
+-- and posts someone following the feed hasn't read are never pruned
+SELECT count(*)
+FROM (
+    SELECT id, created_at, row_number() OVER (ORDER BY COALESCE(published_at, created_at) DESC, id) AS position
+    FROM posts
+    WHERE feed_id = @feed_id::uuid
+) AS ranked
+WHERE (ranked.created_at < @stored_before::timestamp
+OR (@keep_posts::int > 0 AND ranked.position > @keep_posts::int))
+AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = ranked.id)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = @feed_id::uuid
+    AND NOT EXISTS (
+        SELECT 1 FROM post_reads
+        WHERE post_reads.post_id = ranked.id AND post_reads.user_id = feed_follows.user_id
+    )
+);
+--
+
+-- name: DeletePostsToPrune :execrows
+-- Deletes up to batch_size of the posts CountPostsToPrune counts, so each
+-- delete holds its locks briefly. Their guids go in pruned_posts so
+-- UpsertPosts doesn't save them again
+WITH deleted AS (
+    DELETE FROM posts
+    WHERE id IN (
+        SELECT ranked.id
+        FROM (
+            SELECT id, created_at, row_number() OVER (ORDER BY COALESCE(published_at, created_at) DESC, id) AS position
+            FROM posts
+            WHERE feed_id = @feed_id::uuid
+        ) AS ranked
+        WHERE (ranked.created_at < @stored_before::timestamp
+        OR (@keep_posts::int > 0 AND ranked.position > @keep_posts::int))
+        AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = ranked.id)
+        AND NOT EXISTS (
+            SELECT 1 FROM feed_follows
+            WHERE feed_follows.feed_id = @feed_id::uuid
+            AND NOT EXISTS (
+                SELECT 1 FROM post_reads
+                WHERE post_reads.post_id = ranked.id AND post_reads.user_id = feed_follows.user_id
+            )
+        )
+        LIMIT @batch_size::int
+    )
+    RETURNING feed_id, guid
+)
+INSERT INTO pruned_posts (feed_id, guid, pruned_at)
+SELECT feed_id, guid, @now::timestamp
+FROM deleted
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET pruned_at = EXCLUDED.pruned_at;
+--
+
+-- name: UpdateLegacyPostGuids :execrows
+-- Migration 007 gave the posts without a guid their raw url as guid, this
+-- gives them the guid the feed now gives them, matched by url, so they are
+-- updated instead of saved again. A post whose feed already has that guid is
+-- left alone
+UPDATE posts
+SET guid = incoming.guid
+FROM unnest(@urls::text[], @guids::text[]) AS incoming(url, guid)
+WHERE posts.feed_id = @feed_id::uuid
+AND posts.url = incoming.url
+AND posts.guid = posts.url
+AND posts.guid <> incoming.guid
+AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = @feed_id::uuid AND existing.guid = incoming.guid
+);
+--
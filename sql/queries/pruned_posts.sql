@@ -0,0 +1,6 @@
+-- name: ForgetPrunedPosts :execrows
+-- Forgets the pruned posts their feed doesn't list any more, they can't be
+-- saved again so there is nothing to skip
+DELETE FROM pruned_posts
+WHERE feed_id = @feed_id::uuid
+AND NOT (guid = ANY(@guids::text[]));
@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN content TEXT,
+ADD COLUMN guid TEXT,
+ADD COLUMN author TEXT;
+
+CREATE TABLE post_categories (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE (post_id, name)
+);
+
+CREATE TABLE post_enclosures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    length BIGINT,
+    mime_type TEXT,
+    UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
+DROP TABLE post_categories;
+
+ALTER TABLE posts
+DROP COLUMN content,
+DROP COLUMN guid,
+DROP COLUMN author;
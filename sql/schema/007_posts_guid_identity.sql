@@ -0,0 +1,24 @@
+-- +goose Up
+-- Posts without a guid use their link as the identity
+UPDATE posts SET guid = url WHERE guid IS NULL OR guid = '';
+
+ALTER TABLE posts
+ALTER COLUMN guid SET NOT NULL;
+
+-- The same article can now be stored once for each feed that links to it
+ALTER TABLE posts
+DROP CONSTRAINT posts_url_key;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+ALTER TABLE posts
+DROP CONSTRAINT posts_feed_id_guid_key;
+
+-- Fails if two feeds stored the same url, remove the duplicates first
+ALTER TABLE posts
+ADD CONSTRAINT posts_url_key UNIQUE (url);
+
+ALTER TABLE posts
+ALTER COLUMN guid DROP NOT NULL;
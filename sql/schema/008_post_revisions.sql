@@ -0,0 +1,24 @@
+-- +goose Up
+-- Existing posts get their hash on the next fetch, an empty hash never
+-- creates a revision
+ALTER TABLE posts
+ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE post_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT,
+    published_at TIMESTAMP,
+    content_hash TEXT NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_idx ON post_revisions (post_id);
+
+-- +goose Down
+DROP TABLE post_revisions;
+
+ALTER TABLE posts
+DROP COLUMN content_hash;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- The error of the last fetch, NULL when it worked
+ALTER TABLE feeds
+ADD COLUMN last_fetch_error TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_fetch_error;
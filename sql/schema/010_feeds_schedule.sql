@@ -0,0 +1,24 @@
+-- +goose Up
+-- fetch_interval is set with the setinterval command and ttl comes from the
+-- feed, both NULL when not set. fetch_interval is in seconds and ttl in
+-- minutes like the RSS element. skip_hours and skip_days are bit masks, bit n
+-- set skips hour n GMT or weekday n (0 is Sunday). next_fetch_at is NULL
+-- until the first fetch, those feeds are due right away
+ALTER TABLE feeds
+ADD COLUMN fetch_interval INTEGER,
+ADD COLUMN ttl INTEGER,
+ADD COLUMN skip_hours INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN skip_days INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN next_fetch_at TIMESTAMP;
+
+CREATE INDEX feeds_next_fetch_at_idx ON feeds (next_fetch_at);
+
+-- +goose Down
+DROP INDEX feeds_next_fetch_at_idx;
+
+ALTER TABLE feeds
+DROP COLUMN fetch_interval,
+DROP COLUMN ttl,
+DROP COLUMN skip_hours,
+DROP COLUMN skip_days,
+DROP COLUMN next_fetch_at;
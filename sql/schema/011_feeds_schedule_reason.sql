@@ -0,0 +1,8 @@
+-- +goose Up
+-- Why next_fetch_at was picked, shown by the schedule command
+ALTER TABLE feeds
+ADD COLUMN schedule_reason TEXT;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN schedule_reason;
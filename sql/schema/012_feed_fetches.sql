@@ -0,0 +1,21 @@
+-- +goose Up
+-- One row per fetch of a feed. http_status is NULL when no response came
+-- back, error is NULL when the fetch worked. Rows older than the
+-- fetch_history_retention setting are deleted as new ones are added
+CREATE TABLE feed_fetches (
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    http_status INTEGER,
+    bytes BIGINT NOT NULL,
+    items_parsed INTEGER NOT NULL,
+    posts_inserted INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX feed_fetches_feed_id_started_at_idx ON feed_fetches (feed_id, started_at);
+CREATE INDEX feed_fetches_started_at_idx ON feed_fetches (started_at);
+
+-- +goose Down
+DROP TABLE feed_fetches;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- How long and how many posts of a feed are kept, set with the setretention
+-- command. NULL uses the post_retention_days and post_retention_posts
+-- settings and 0 keeps the posts of the feed forever
+ALTER TABLE feeds
+ADD COLUMN retention_days INTEGER,
+ADD COLUMN retention_posts INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN retention_days,
+DROP COLUMN retention_posts;
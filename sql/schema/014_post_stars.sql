@@ -0,0 +1,14 @@
+-- +goose Up
+-- The posts each user starred, prune never deletes a starred post
+CREATE TABLE post_stars (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    UNIQUE (user_id, post_id)
+);
+
+CREATE INDEX post_stars_post_id_idx ON post_stars (post_id);
+
+-- +goose Down
+DROP TABLE post_stars;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- The guids of the posts prune deleted, so fetches don't save them again
+-- while their feed still lists them. A guid is forgotten once its feed stops
+-- listing it
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    guid TEXT NOT NULL,
+    pruned_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (feed_id, guid)
+);
+
+-- +goose Down
+DROP TABLE pruned_posts;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- The feeds with posts that migration 007 gave their raw url as guid. The
+-- next fetch of each feed moves those posts to the guid the feed gives them
+-- now and takes the feed off this list
+CREATE TABLE legacy_guid_feeds (
+    feed_id UUID PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+INSERT INTO legacy_guid_feeds (feed_id)
+SELECT DISTINCT feed_id FROM posts WHERE guid = url;
+
+-- +goose Down
+DROP TABLE legacy_guid_feeds;
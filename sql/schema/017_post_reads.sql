@@ -0,0 +1,15 @@
+-- +goose Up
+-- The posts each user read, prune keeps a post until everyone following its
+-- feed has read it
+CREATE TABLE post_reads (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    UNIQUE (user_id, post_id)
+);
+
+CREATE INDEX post_reads_post_id_idx ON post_reads (post_id);
+
+-- +goose Down
+DROP TABLE post_reads;
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jcourtney5/blog-aggregator/internal/config"
+	"github.com/jcourtney5/blog-aggregator/internal/database"
+	"github.com/jcourtney5/blog-aggregator/internal/database/sqlite"
+)
+
+// openStore opens the storage backend for the db_url, postgres:// URLs use
+// Postgres and sqlite: or file: URLs use a SQLite file
+func openStore(dbURL string) (database.Store, error) {
+	scheme, rest, ok := strings.Cut(dbURL, ":")
+	if !ok {
+		return nil, fmt.Errorf("db_url %q has no scheme, use postgres:// or sqlite://", dbURL)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return database.OpenPostgres(dbURL)
+	case "sqlite", "sqlite3":
+		// sqlite:///abs/path.db, sqlite://rel/path.db and sqlite:path.db
+		return sqlite.Open(strings.TrimPrefix(rest, "//"))
+	case "file":
+		return sqlite.Open(dbURL)
+	}
+	return nil, fmt.Errorf("unsupported db_url scheme %q in %s, use postgres:// or sqlite://", scheme, config.RedactURL(dbURL))
+}